@@ -0,0 +1,108 @@
+// +build linux
+
+package iouring
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// WriteFileAtomic writes data to a file so that the path contains either the
+// previous contents or data, even after a crash. The data is written to a
+// temporary file in the same directory which is synced and renamed over the
+// path, then the directory is synced. If the file doesn't exist it is
+// created with perm (before umask).
+func (r *Ring) WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+
+	fd, tmp, err := r.createTemp(dir, base, perm)
+	if err != nil {
+		return &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	if err := r.writeSync(fd, data); err != nil {
+		r.Close(fd)
+		r.removeTemp(tmp)
+		return &os.PathError{Op: "write", Path: tmp, Err: err}
+	}
+	if err := r.Close(fd); err != nil {
+		r.removeTemp(tmp)
+		return &os.PathError{Op: "close", Path: tmp, Err: err}
+	}
+	if err := r.RenameAt(unix.AT_FDCWD, tmp, unix.AT_FDCWD, path, 0); err != nil {
+		r.removeTemp(tmp)
+		return &os.LinkError{Op: "rename", Old: tmp, New: path, Err: err}
+	}
+	if err := r.syncDir(dir); err != nil {
+		return &os.PathError{Op: "fsync", Path: dir, Err: err}
+	}
+	return nil
+}
+
+// createTemp is used to exclusively create a temporary file in a directory.
+func (r *Ring) createTemp(dir string, base string, perm os.FileMode) (int, string, error) {
+	flags := unix.O_WRONLY | unix.O_CREAT | unix.O_EXCL | unix.O_CLOEXEC
+	for i := 0; i < 100; i++ {
+		tmp := filepath.Join(dir, "."+base+".tmp"+strconv.FormatUint(r.ID(), 36))
+		fd, err := r.OpenAt(unix.AT_FDCWD, tmp, flags, uint32(perm.Perm()))
+		if err == syscall.EEXIST {
+			continue
+		}
+		return fd, tmp, err
+	}
+	return -1, "", syscall.EEXIST
+}
+
+// writeSync is used to preallocate, write and sync data to a file.
+func (r *Ring) writeSync(fd int, data []byte) error {
+	if len(data) > 0 {
+		// Preallocating is only an optimization.
+		err := r.Fallocate(fd, 0, 0, int64(len(data)))
+		if err != nil && err != syscall.EOPNOTSUPP {
+			return err
+		}
+	}
+	for off := 0; off < len(data); {
+		id, err := r.PrepareWrite(fd, data[off:], uint64(off), 0)
+		if err != nil {
+			return err
+		}
+		n, err := r.wait(id)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return syscall.EIO
+		}
+		off += int(n)
+	}
+	runtime.KeepAlive(data)
+	return r.Fsync(fd, int(FsyncDatasync))
+}
+
+// syncDir is used to fsync a directory so that renames are durable.
+func (r *Ring) syncDir(dir string) error {
+	fd, err := r.OpenAt(unix.AT_FDCWD, dir, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	err = r.Fsync(fd, 0)
+	if cerr := r.Close(fd); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// removeTemp is used to remove a temporary file after a failure.
+func (r *Ring) removeTemp(tmp string) {
+	if err := r.UnlinkAt(unix.AT_FDCWD, tmp, 0); err == ErrNotSupported {
+		os.Remove(tmp)
+	}
+}
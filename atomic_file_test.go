@@ -0,0 +1,75 @@
+// +build linux
+
+package iouring
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRingWriteFileAtomic(t *testing.T) {
+	r, err := New(2048, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+
+	dir, err := ioutil.TempDir("", "atomic")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config")
+	require.NoError(t, r.WriteFileAtomic(path, []byte("first"), 0600))
+	b, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "first", string(b))
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+
+	data := make([]byte, 1<<20)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	require.NoError(t, r.WriteFileAtomic(path, data, 0600))
+	b, err = ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, data, b)
+
+	require.NoError(t, r.WriteFileAtomic(path, nil, 0600))
+	b, err = ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Empty(t, b)
+
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+}
+
+func TestRingWriteFileAtomicCleanup(t *testing.T) {
+	r, err := New(2048, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+
+	dir, err := ioutil.TempDir("", "atomic")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// Renaming a file over a non empty directory fails.
+	target := filepath.Join(dir, "target")
+	require.NoError(t, os.MkdirAll(filepath.Join(target, "sub"), 0755))
+	err = r.WriteFileAtomic(target, []byte("test"), 0644)
+	require.Error(t, err)
+	_, ok := err.(*os.LinkError)
+	require.True(t, ok)
+
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	require.Equal(t, "target", files[0].Name())
+
+	err = r.WriteFileAtomic(filepath.Join(dir, "missing", "file"), nil, 0644)
+	require.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,194 @@
+// +build linux
+
+package iouring
+
+import (
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	// maxBufferRingEntries is the maximum number of entries of a buffer
+	// ring.
+	maxBufferRingEntries = 1 << 15
+
+	// bufferRingEntrySize is the size of a struct io_uring_buf.
+	bufferRingEntrySize = 16
+)
+
+// bufferRingEntry is a struct io_uring_buf, the resv field of the first entry
+// is the tail of the ring.
+type bufferRingEntry struct {
+	Addr uint64
+	Len  uint32
+	Bid  uint16
+	Resv uint16
+}
+
+// bufferRingReg is a struct io_uring_buf_reg.
+type bufferRingReg struct {
+	RingAddr    uint64
+	RingEntries uint32
+	Bgid        uint16
+	Flags       uint16
+	Resv        [3]uint64
+}
+
+// RegisterBufferRing is used to register a ring of provided buffers for a
+// buffer group, the ring memory must be page aligned and entries must be a
+// power of 2.
+func RegisterBufferRing(ringFd int, addr uintptr, entries int, group uint16) error {
+	reg := bufferRingReg{
+		RingAddr:    uint64(addr),
+		RingEntries: uint32(entries),
+		Bgid:        group,
+	}
+	_, _, errno := syscall.Syscall6(
+		RegisterSyscall,
+		uintptr(ringFd),
+		uintptr(RegRegisterPbufRing),
+		uintptr(unsafe.Pointer(&reg)),
+		uintptr(1),
+		uintptr(0),
+		uintptr(0),
+	)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// UnregisterBufferRing is used to unregister the buffer ring of a buffer
+// group.
+func UnregisterBufferRing(ringFd int, group uint16) error {
+	reg := bufferRingReg{Bgid: group}
+	_, _, errno := syscall.Syscall6(
+		RegisterSyscall,
+		uintptr(ringFd),
+		uintptr(RegUnregisterPbufRing),
+		uintptr(unsafe.Pointer(&reg)),
+		uintptr(1),
+		uintptr(0),
+		uintptr(0),
+	)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// bufferRing is a BufferGroup that uses a registered buffer ring, buffers are
+// returned to the kernel by advancing the tail of the ring without a SQE.
+type bufferRing struct {
+	r    *Ring
+	id   uint16
+	size int
+	n    int
+	mem  []byte
+
+	mu      sync.Mutex
+	entries []bufferRingEntry
+	mask    uint16
+	tail    uint16
+}
+
+// newBufferRing is used to create and register a buffer ring.
+func (r *Ring) newBufferRing(id uint16, n int, size int) (*bufferRing, error) {
+	entries := 1
+	for entries < n {
+		entries <<= 1
+	}
+	ring := pageAligned(entries * bufferRingEntrySize)
+	g := &bufferRing{
+		r:       r,
+		id:      id,
+		size:    size,
+		n:       n,
+		mem:     pageAligned(n * size),
+		entries: (*[maxBufferRingEntries]bufferRingEntry)(unsafe.Pointer(&ring[0]))[:entries:entries],
+		mask:    uint16(entries - 1),
+	}
+	err := r.issue(func() error {
+		return RegisterBufferRing(r.fd, uintptr(unsafe.Pointer(&ring[0])), entries, id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	g.mu.Lock()
+	for bid := 0; bid < n; bid++ {
+		g.add(uint16(bid))
+	}
+	g.publish()
+	g.mu.Unlock()
+	return g, nil
+}
+
+// add is used to add a buffer at the tail, the lock must be held and the
+// tail published afterwards.
+func (g *bufferRing) add(bid uint16) {
+	e := &g.entries[g.tail&g.mask]
+	e.Addr = uint64(uintptr(unsafe.Pointer(&g.mem[int(bid)*g.size])))
+	e.Len = uint32(g.size)
+	if e == &g.entries[0] {
+		// The tail shares the word with the bid of the first entry.
+		g.storeWord(uint32(bid) | atomic.LoadUint32(g.word())&0xffff0000)
+	} else {
+		e.Bid = bid
+	}
+	g.tail++
+}
+
+// publish is used to make added buffers visible to the kernel.
+func (g *bufferRing) publish() {
+	g.storeWord(atomic.LoadUint32(g.word())&0xffff | uint32(g.tail)<<16)
+}
+
+// word returns the 32 bit word that holds the bid of the first entry and the
+// tail of the ring.
+func (g *bufferRing) word() *uint32 {
+	return (*uint32)(unsafe.Pointer(&g.entries[0].Bid))
+}
+
+func (g *bufferRing) storeWord(v uint32) {
+	atomic.StoreUint32(g.word(), v)
+}
+
+// ID implements the BufferGroup interface.
+func (g *bufferRing) ID() uint16 {
+	return g.id
+}
+
+// Buffer implements the BufferGroup interface.
+func (g *bufferRing) Buffer(bid uint16) []byte {
+	off := int(bid) * g.size
+	return g.mem[off : off+g.size]
+}
+
+// Release implements the BufferGroup interface.
+func (g *bufferRing) Release(bid uint16) error {
+	if int(bid) >= g.n {
+		return syscall.EINVAL
+	}
+	g.mu.Lock()
+	g.add(bid)
+	g.publish()
+	g.mu.Unlock()
+	return nil
+}
+
+// Advise implements the BufferGroup interface.
+func (g *bufferRing) Advise(advice int) error {
+	return g.r.Madvise(g.mem, advice)
+}
+
+// Close implements the BufferGroup interface.
+func (g *bufferRing) Close() error {
+	err := g.r.issue(func() error { return UnregisterBufferRing(g.r.fd, g.id) })
+	if err != nil {
+		return err
+	}
+	g.r.bgids.release(g.id)
+	return nil
+}
@@ -0,0 +1,125 @@
+// +build linux
+
+package iouring
+
+import (
+	"fmt"
+	"syscall"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBufferRingEntrySize(t *testing.T) {
+	require.Equal(t, uintptr(bufferRingEntrySize), unsafe.Sizeof(bufferRingEntry{}))
+	require.Equal(t, uintptr(40), unsafe.Sizeof(bufferRingReg{}))
+}
+
+// recvAll is used to receive messages through a buffer group with fewer
+// buffers than messages so that buffers must be recycled.
+func recvAll(t *testing.T, r *Ring, bg BufferGroup) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_DGRAM, 0)
+	require.NoError(t, err)
+	defer syscall.Close(fds[0])
+	defer syscall.Close(fds[1])
+
+	ms, err := r.RecvMultishot(fds[0], bg.ID(), 0)
+	require.NoError(t, err)
+
+	seen := map[uint16]bool{}
+	for i := 0; i < 16; i++ {
+		msg := fmt.Sprintf("message %d", i)
+		_, err = syscall.Write(fds[1], []byte(msg))
+		require.NoError(t, err)
+		cqe := <-ms.C
+		require.Equal(t, int32(len(msg)), cqe.Res)
+		bid, ok := CqeBufferID(&cqe)
+		require.True(t, ok)
+		seen[bid] = true
+		require.Equal(t, msg, string(bg.Buffer(bid)[:cqe.Res]))
+		require.NoError(t, bg.Release(bid))
+	}
+	require.Len(t, seen, 2)
+
+	require.NoError(t, ms.Cancel())
+	for range ms.C {
+	}
+	require.NoError(t, bg.Close())
+}
+
+func TestBufferRing(t *testing.T) {
+	r, err := New(2048, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	if !r.MultishotSupported(Recv) {
+		t.Skip("multishot recv not supported")
+	}
+
+	bg, err := r.NewBufferGroup(2, 64)
+	require.NoError(t, err)
+	if _, ok := bg.(*bufferRing); !ok {
+		t.Skip("buffer rings not supported")
+	}
+	require.Equal(t, syscall.EINVAL, bg.Release(2))
+	recvAll(t, r, bg)
+}
+
+func TestProvidedBuffersFallback(t *testing.T) {
+	r, err := New(2048, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	if !r.MultishotSupported(Recv) {
+		t.Skip("multishot recv not supported")
+	}
+
+	id, err := r.bgids.alloc()
+	require.NoError(t, err)
+	bg, err := r.newProvidedBuffers(id, 2, 64)
+	require.NoError(t, err)
+	recvAll(t, r, bg)
+}
+
+func benchmarkRelease(b *testing.B, bg BufferGroup) {
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := bg.Release(uint16(i % 64)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBufferRingRelease(b *testing.B) {
+	r, err := New(2048, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	id, err := r.bgids.alloc()
+	if err != nil {
+		b.Fatal(err)
+	}
+	g, err := r.newBufferRing(id, 64, 64)
+	if err != nil {
+		b.Skip(err)
+	}
+	defer g.Close()
+	benchmarkRelease(b, g)
+}
+
+func BenchmarkProvidedBuffersRelease(b *testing.B) {
+	r, err := New(2048, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	id, err := r.bgids.alloc()
+	if err != nil {
+		b.Fatal(err)
+	}
+	g, err := r.newProvidedBuffers(id, 64, 64)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer g.Close()
+	benchmarkRelease(b, g)
+}
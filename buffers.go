@@ -0,0 +1,267 @@
+// +build linux
+
+package iouring
+
+import (
+	"encoding/binary"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// maxGroupBuffers is the maximum number of buffers in a group, buffer
+	// ids are 16 bits.
+	maxGroupBuffers = 1 << 16
+)
+
+// ErrNoBufferGroups is returned when all buffer group ids of a ring are in
+// use.
+var ErrNoBufferGroups = errors.New("no free buffer group ids")
+
+// groupIDs is used to allocate buffer group ids, the ids of closed groups
+// are reused.
+type groupIDs struct {
+	mu   sync.Mutex
+	last uint16
+	free []uint16
+}
+
+// alloc returns a free group id, ids start at one.
+func (g *groupIDs) alloc() (uint16, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if n := len(g.free); n > 0 {
+		id := g.free[n-1]
+		g.free = g.free[:n-1]
+		return id, nil
+	}
+	if g.last == 1<<16-1 {
+		return 0, ErrNoBufferGroups
+	}
+	g.last++
+	return g.last, nil
+}
+
+// release returns the id of a closed group.
+func (g *groupIDs) release(id uint16) {
+	g.mu.Lock()
+	g.free = append(g.free, id)
+	g.mu.Unlock()
+}
+
+// BufferGroup is a group of buffers provided to the kernel for requests
+// that select a buffer when they complete (see SqeBufferSelect).
+type BufferGroup interface {
+	// ID returns the id of the group.
+	ID() uint16
+	// Buffer returns the buffer with the id from a completion's flags.
+	Buffer(bid uint16) []byte
+	// Release returns a buffer to the kernel after it has been consumed.
+	Release(bid uint16) error
+	// Advise is used to madvise the memory of the group, for example
+	// MADV_DONTNEED when a pool shrinks or MADV_WILLNEED when it warms up.
+	Advise(advice int) error
+	// Close removes the buffers from the kernel.
+	Close() error
+}
+
+// pageAligned returns a page aligned buffer so that it can be advised. The
+// allocation is padded to a whole number of pages because madvise rounds the
+// length up, advising a partial page would affect the objects after it.
+func pageAligned(size int) []byte {
+	page := os.Getpagesize()
+	b := make([]byte, (size+page-1)/page*page+page)
+	off := 0
+	if rem := int(uintptr(unsafe.Pointer(&b[0])) & uintptr(page-1)); rem != 0 {
+		off = page - rem
+	}
+	return b[off : off+size : off+size]
+}
+
+// setBufGroup is used to set the buffer group of a SubmitEntry.
+func setBufGroup(sqe *SubmitEntry, group uint16) {
+	binary.LittleEndian.PutUint16(sqe.Anon0[0:2], group)
+}
+
+// CqeBufferID returns the buffer id of a CQE that selected a buffer and
+// whether a buffer was selected.
+func CqeBufferID(cqe *CompletionEntry) (uint16, bool) {
+	if cqe.Flags&CqeFBuffer == 0 {
+		return 0, false
+	}
+	return uint16(cqe.Flags >> CqeBufferShift), true
+}
+
+// PrepareProvideBuffers is used to prepare a SQE to provide n buffers of
+// size bytes each starting at addr to a buffer group, the buffers are given
+// ids starting from bid.
+func (r *Ring) PrepareProvideBuffers(
+	addr uintptr, size int, n int, group uint16, bid uint16, opts ...OpOption) (uint64, error) {
+	sqe, ready := r.SubmitEntry()
+	if sqe == nil {
+		return 0, errRingUnavailable
+	}
+
+	sqe.Opcode = ProvideBuffers
+	sqe.UserData = r.ID()
+	sqe.Fd = int32(n)
+	sqe.Addr = uint64(addr)
+	sqe.Len = uint32(size)
+	sqe.Offset = uint64(bid)
+	setBufGroup(sqe, group)
+
+	r.applyOpOptions(sqe, opts)
+	ready()
+	return sqe.UserData, nil
+}
+
+// ProvideBuffers is used to provide buffers to a buffer group.
+func (r *Ring) ProvideBuffers(
+	addr uintptr, size int, n int, group uint16, bid uint16, opts ...OpOption) error {
+	id, err := r.PrepareProvideBuffers(addr, size, n, group, bid, opts...)
+	if err != nil {
+		return err
+	}
+	errno, _ := r.complete(id)
+	if errno < 0 {
+		return syscall.Errno(-errno)
+	}
+	return nil
+}
+
+// PrepareRemoveBuffers is used to prepare a SQE to remove n buffers from a
+// buffer group.
+func (r *Ring) PrepareRemoveBuffers(n int, group uint16, opts ...OpOption) (uint64, error) {
+	sqe, ready := r.SubmitEntry()
+	if sqe == nil {
+		return 0, errRingUnavailable
+	}
+
+	sqe.Opcode = RemoveBuffers
+	sqe.UserData = r.ID()
+	sqe.Fd = int32(n)
+	setBufGroup(sqe, group)
+
+	r.applyOpOptions(sqe, opts)
+	ready()
+	return sqe.UserData, nil
+}
+
+// RemoveBuffers is used to remove buffers from a buffer group, it returns the
+// number of buffers removed.
+func (r *Ring) RemoveBuffers(n int, group uint16, opts ...OpOption) (int, error) {
+	id, err := r.PrepareRemoveBuffers(n, group, opts...)
+	if err != nil {
+		return 0, err
+	}
+	res, _ := r.complete(id)
+	if res < 0 {
+		return 0, syscall.Errno(-res)
+	}
+	return int(res), nil
+}
+
+// NewBufferGroup is used to provide n buffers of size bytes to the kernel,
+// the group id is allocated by the ring. A registered buffer ring is used
+// when the kernel supports it, otherwise the buffers are provided with the
+// ProvideBuffers opcode.
+func (r *Ring) NewBufferGroup(n int, size int) (BufferGroup, error) {
+	if n < 1 || n > maxGroupBuffers || size < 1 {
+		return nil, errors.New("invalid buffer group size")
+	}
+	id, err := r.bgids.alloc()
+	if err != nil {
+		return nil, err
+	}
+	if n <= maxBufferRingEntries {
+		g, err := r.newBufferRing(id, n, size)
+		if err == nil {
+			return g, nil
+		}
+		if err != syscall.EINVAL {
+			r.bgids.release(id)
+			return nil, errors.Wrap(err, "failed to register buffer ring")
+		}
+		// Older kernels don't support buffer rings.
+	}
+	g, err := r.newProvidedBuffers(id, n, size)
+	if err != nil {
+		r.bgids.release(id)
+		return nil, err
+	}
+	return g, nil
+}
+
+// newProvidedBuffers is used to create a BufferGroup that uses the
+// ProvideBuffers opcode.
+func (r *Ring) newProvidedBuffers(id uint16, n int, size int) (*providedBuffers, error) {
+	g := &providedBuffers{
+		r:    r,
+		id:   id,
+		size: size,
+		n:    n,
+		mem:  pageAligned(n * size),
+	}
+	if err := r.ProvideBuffers(g.addr(0), size, n, g.id, 0); err != nil {
+		return nil, errors.Wrap(err, "failed to provide buffers")
+	}
+	return g, nil
+}
+
+// providedBuffers is a BufferGroup that uses the ProvideBuffers opcode.
+type providedBuffers struct {
+	r      *Ring
+	id     uint16
+	size   int
+	n      int
+	mem    []byte
+	closed int32
+}
+
+func (g *providedBuffers) addr(bid uint16) uintptr {
+	return uintptr(unsafe.Pointer(&g.mem[int(bid)*g.size]))
+}
+
+// ID implements the BufferGroup interface.
+func (g *providedBuffers) ID() uint16 {
+	return g.id
+}
+
+// Buffer implements the BufferGroup interface.
+func (g *providedBuffers) Buffer(bid uint16) []byte {
+	off := int(bid) * g.size
+	return g.mem[off : off+g.size]
+}
+
+// Release implements the BufferGroup interface.
+func (g *providedBuffers) Release(bid uint16) error {
+	err := g.r.ProvideBuffers(g.addr(bid), g.size, 1, g.id, bid)
+	runtime.KeepAlive(g.mem)
+	return err
+}
+
+// Advise implements the BufferGroup interface.
+func (g *providedBuffers) Advise(advice int) error {
+	return g.r.Madvise(g.mem, advice)
+}
+
+// Close implements the BufferGroup interface.
+func (g *providedBuffers) Close() error {
+	if !atomic.CompareAndSwapInt32(&g.closed, 0, 1) {
+		return syscall.EINVAL
+	}
+	_, err := g.r.RemoveBuffers(g.n, g.id)
+	if err != nil && err != syscall.ENOENT {
+		atomic.StoreInt32(&g.closed, 0)
+		return err
+	}
+	// ENOENT is returned when all buffers are in use.
+	g.r.bgids.release(g.id)
+	return nil
+}
@@ -0,0 +1,102 @@
+// +build linux
+
+package iouring
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestPageAligned(t *testing.T) {
+	page := os.Getpagesize()
+	for _, size := range []int{1, page - 1, page, 3*page + 1} {
+		b := pageAligned(size)
+		require.Len(t, b, size)
+		require.Equal(t, size, cap(b))
+		require.Zero(t, uintptr(unsafe.Pointer(&b[0]))%uintptr(page))
+	}
+}
+
+func TestBufferGroupAdvise(t *testing.T) {
+	r, err := New(2048, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+
+	g, err := r.NewBufferGroup(16, 4096)
+	require.NoError(t, err)
+	defer g.Close()
+
+	require.NoError(t, g.Advise(unix.MADV_WILLNEED))
+	err = g.Advise(unix.MADV_HUGEPAGE)
+	if err != syscall.EINVAL {
+		// Transparent huge pages may be disabled.
+		require.NoError(t, err)
+	}
+	copy(g.Buffer(1), "test")
+	require.NoError(t, g.Advise(unix.MADV_DONTNEED))
+	require.Equal(t, make([]byte, 4), g.Buffer(1)[:4])
+}
+
+func TestBufferGroupAdviseNeighbours(t *testing.T) {
+	r, err := New(2048, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	defer r.Stop()
+
+	// Allocations of the same size class are likely to share pages with
+	// the groups.
+	var neighbours [][]byte
+	var groups []BufferGroup
+	for i := 0; i < 16; i++ {
+		b := make([]byte, 100+os.Getpagesize())
+		for j := range b {
+			b[j] = 0xaa
+		}
+		neighbours = append(neighbours, b)
+		g, err := r.NewBufferGroup(1, 100)
+		require.NoError(t, err)
+		defer g.Close()
+		groups = append(groups, g)
+	}
+	for _, g := range groups {
+		copy(g.Buffer(0), "test")
+		require.NoError(t, g.Advise(unix.MADV_DONTNEED))
+		require.Equal(t, make([]byte, 4), g.Buffer(0)[:4])
+	}
+	for _, b := range neighbours {
+		for j := range b {
+			if b[j] != 0xaa {
+				t.Fatalf("neighbouring allocation was zeroed at %d", j)
+			}
+		}
+	}
+}
+
+func TestBufferGroupIDs(t *testing.T) {
+	r, err := New(1024, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+
+	g, err := r.NewBufferGroup(1, 64)
+	require.NoError(t, err)
+	id := g.ID()
+	require.NoError(t, g.Close())
+	g, err = r.NewBufferGroup(1, 64)
+	require.NoError(t, err)
+	require.Equal(t, id, g.ID())
+
+	// Exhaust the ids, the closed group's id is the only free id.
+	r.bgids.last = 1<<16 - 1
+	require.NoError(t, g.Close())
+	g, err = r.NewBufferGroup(1, 64)
+	require.NoError(t, err)
+	require.Equal(t, id, g.ID())
+	_, err = r.NewBufferGroup(1, 64)
+	require.Equal(t, ErrNoBufferGroups, err)
+	require.NoError(t, g.Close())
+}
@@ -0,0 +1,218 @@
+// +build linux
+
+// Command iouring-replay re-issues a trace recorded with the iouring
+// WithRecorder option against files in a scratch directory and compares the
+// results with the recorded completions.
+//
+// Addresses in a trace are only valid in the recording process, so file IO is
+// replayed with freshly allocated buffers of the recorded length against one
+// scratch file per recorded file descriptor. Operations that can't be replayed
+// this way are skipped.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/hodgesds/iouring-go"
+)
+
+var (
+	tracePath string
+	dir       string
+	ringSize  uint
+	verbose   bool
+)
+
+func init() {
+	flag.StringVar(&tracePath, "trace", "", "trace file to replay")
+	flag.StringVar(&dir, "dir", "", "scratch directory (default temp dir)")
+	flag.UintVar(&ringSize, "size", 1024, "ring size")
+	flag.BoolVar(&verbose, "v", false, "print every mismatch")
+}
+
+type replayer struct {
+	r     *iouring.Ring
+	dir   string
+	files map[int32]iouring.ReadWriteSeekerCloser
+	fds   map[int32]int
+}
+
+func (p *replayer) file(fd int32) (iouring.ReadWriteSeekerCloser, int, error) {
+	if rw, ok := p.files[fd]; ok {
+		return rw, p.fds[fd], nil
+	}
+	f, err := os.OpenFile(
+		filepath.Join(p.dir, fmt.Sprintf("fd-%d", fd)),
+		os.O_RDWR|os.O_CREATE,
+		0644,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	rw, err := p.r.FileReadWriter(f)
+	if err != nil {
+		return nil, 0, err
+	}
+	p.files[fd] = rw
+	p.fds[fd] = int(f.Fd())
+	return rw, int(f.Fd()), nil
+}
+
+// replay re-issues a SubmitEntry and returns the result in the same format
+// as a CompletionEntry Res field.
+func (p *replayer) replay(sqe *iouring.SubmitEntry) (int32, bool, error) {
+	switch sqe.Opcode {
+	case iouring.Nop:
+		return errRes(p.r.Nop()), true, nil
+	case iouring.Read, iouring.ReadFixed:
+		rw, _, err := p.file(sqe.Fd)
+		if err != nil {
+			return 0, false, err
+		}
+		n, err := rw.ReadAt(make([]byte, sqe.Len), int64(sqe.Offset))
+		if err != nil && err != io.EOF {
+			return errRes(err), true, nil
+		}
+		return int32(n), true, nil
+	case iouring.Write, iouring.WriteFixed:
+		rw, _, err := p.file(sqe.Fd)
+		if err != nil {
+			return 0, false, err
+		}
+		n, err := rw.WriteAt(make([]byte, sqe.Len), int64(sqe.Offset))
+		if err != nil {
+			return errRes(err), true, nil
+		}
+		return int32(n), true, nil
+	case iouring.Fsync:
+		_, fd, err := p.file(sqe.Fd)
+		if err != nil {
+			return 0, false, err
+		}
+		return errRes(p.r.Fsync(fd, int(sqe.UFlags))), true, nil
+	case iouring.Fallocate:
+		_, fd, err := p.file(sqe.Fd)
+		if err != nil {
+			return 0, false, err
+		}
+		return errRes(p.r.Fallocate(
+			fd, sqe.Len, int64(sqe.Offset), int64(sqe.Addr),
+		)), true, nil
+	case iouring.Fadvise:
+		_, fd, err := p.file(sqe.Fd)
+		if err != nil {
+			return 0, false, err
+		}
+		return errRes(p.r.Fadvise(
+			fd, sqe.Offset, sqe.Len, int(sqe.UFlags),
+		)), true, nil
+	default:
+		return 0, false, nil
+	}
+}
+
+func errRes(err error) int32 {
+	if err == nil {
+		return 0
+	}
+	if errno, ok := err.(syscall.Errno); ok {
+		return -int32(errno)
+	}
+	return -int32(syscall.EIO)
+}
+
+func main() {
+	flag.Parse()
+	if tracePath == "" {
+		log.Fatal("-trace is required")
+	}
+	f, err := os.Open(tracePath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	if dir == "" {
+		dir, err = ioutil.TempDir("", "iouring-replay")
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+	}
+
+	// Completions may be recorded before or after later submissions, so
+	// read the whole trace before replaying.
+	var (
+		sqes []*iouring.SubmitEntry
+		res  = map[uint64]int32{}
+		tr   = iouring.NewTraceReader(f)
+	)
+	for {
+		rec, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		switch rec.Kind {
+		case iouring.TraceSubmit:
+			sqes = append(sqes, rec.SQE)
+		case iouring.TraceComplete:
+			res[rec.CQE.UserData] = rec.CQE.Res
+		}
+	}
+
+	r, err := iouring.New(ringSize, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	p := &replayer{
+		r:     r,
+		dir:   dir,
+		files: map[int32]iouring.ReadWriteSeekerCloser{},
+		fds:   map[int32]int{},
+	}
+
+	var matched, mismatched, skipped, missing int
+	for _, sqe := range sqes {
+		got, ok, err := p.replay(sqe)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !ok {
+			skipped++
+			continue
+		}
+		want, ok := res[sqe.UserData]
+		if !ok {
+			missing++
+			continue
+		}
+		if got != want {
+			mismatched++
+			if verbose {
+				fmt.Printf(
+					"mismatch: op %d user data %d: recorded %d replayed %d\n",
+					sqe.Opcode, sqe.UserData, want, got,
+				)
+			}
+			continue
+		}
+		matched++
+	}
+	fmt.Printf(
+		"submissions: %d matched: %d mismatched: %d skipped: %d no completion: %d\n",
+		len(sqes), matched, mismatched, skipped, missing,
+	)
+	if mismatched > 0 {
+		os.Exit(1)
+	}
+}
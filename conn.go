@@ -87,11 +87,13 @@ func (l *ringListener) run() {
 		id: id,
 	}
 	sqe, commit := l.r.SubmitEntry()
-	sqe.Opcode = PollAdd
-	sqe.Fd = int32(fd)
-	sqe.UFlags = int32(POLLIN)
-	sqe.UserData = id
-	commit()
+	if sqe != nil {
+		sqe.Opcode = PollAdd
+		sqe.Fd = int32(fd)
+		sqe.UFlags = int32(POLLIN)
+		sqe.UserData = id
+		commit()
+	}
 
 	conns := map[uint64]*connInfo{id: cInfo}
 
@@ -133,7 +135,7 @@ func (l *ringListener) walkCq(conns map[uint64]*connInfo) {
 		fmt.Printf("cq head: %v tail: %v\ncq entries: %+v\n", cqHead&cqMask, cqTail&cqMask, l.r.cq.Entries[:9])
 	}
 	for i := seenIdx; i <= tail&mask; i++ {
-		cqe := l.r.cq.Entries[i]
+		cqe := *l.r.cq.Entry(i)
 		if (cqe.Flags&CqSeenFlag == CqSeenFlag || cqe.IsZero()) && !seenEnd {
 			seenIdx = i
 		} else {
@@ -143,7 +145,7 @@ func (l *ringListener) walkCq(conns map[uint64]*connInfo) {
 		if !ok {
 			continue
 		}
-		l.r.cq.Entries[i].Flags |= CqSeenFlag
+		l.r.cq.Entry(i).Flags |= CqSeenFlag
 		head = atomic.LoadUint32(l.r.cq.Head)
 		if seenIdx > head {
 			atomic.CompareAndSwapUint32(l.r.cq.Head, head, seenIdx)
@@ -158,7 +160,7 @@ func (l *ringListener) walkCq(conns map[uint64]*connInfo) {
 	tail = atomic.LoadUint32(l.r.cq.Tail)
 	mask = atomic.LoadUint32(l.r.cq.Mask)
 	for i := uint32(0); i <= tail&mask; i++ {
-		cqe := l.r.cq.Entries[i]
+		cqe := *l.r.cq.Entry(i)
 		if (cqe.Flags&CqSeenFlag == CqSeenFlag || cqe.IsZero()) && !seenEnd {
 			seenIdx = i
 		} else {
@@ -168,7 +170,7 @@ func (l *ringListener) walkCq(conns map[uint64]*connInfo) {
 		if !ok {
 			continue
 		}
-		l.r.cq.Entries[i].Flags |= CqSeenFlag
+		l.r.cq.Entry(i).Flags |= CqSeenFlag
 		head = atomic.LoadUint32(l.r.cq.Head)
 		if seenIdx > head {
 			atomic.CompareAndSwapUint32(l.r.cq.Head, head, seenIdx)
@@ -180,61 +182,115 @@ func (l *ringListener) walkCq(conns map[uint64]*connInfo) {
 
 // onListen is called when processing a cqe for a listening socket.
 func (l *ringListener) onListen(conns map[uint64]*connInfo, cInfo *connInfo) {
-	var (
-		newConnInfo connInfo
-		offset      int64
-		rc          = ringConn{
-			stop: make(chan struct{}, 2),
-			poll: make(chan uint64, 64),
-			r:    l.r,
-		}
-	)
-	for {
-		// Wait for a new connection to arrive and add it to the ring.
-		newFd, sa, err := syscall.Accept4(cInfo.fd, syscall.SOCK_NONBLOCK)
-		if err != nil {
-			// TODO: Log this or something?
-			panic(err.Error())
-		}
-		rc.fd = newFd
-		rc.laddr = l.a
-		rc.raddr = &addr{net: l.a.net}
-		switch sockType := sa.(type) {
-		case *syscall.SockaddrInet4:
-			rc.raddr.s = fmt.Sprintf("%s:%d", sockType.Addr, sockType.Port)
-		case *syscall.SockaddrInet6:
-			rc.raddr.s = fmt.Sprintf("%s:%d", sockType.Addr, sockType.Port)
-		case *syscall.SockaddrUnix:
-			rc.raddr.s = sockType.Name
-		}
-		rc.offset = &offset
-		break
+	var newConnInfo connInfo
+	// Wait for a new connection to arrive and add it to the ring.
+	newFd, sa, err := syscall.Accept4(cInfo.fd, syscall.SOCK_NONBLOCK)
+	if err != nil {
+		// TODO: Log this or something?
+		panic(err.Error())
 	}
+	rc := l.newRingConn(newFd, sa)
 
 	// Add the new connection back to the ring.
 	sqe, commit := l.r.SubmitEntry()
-	sqe.Opcode = PollAdd
-	sqe.Fd = int32(rc.fd)
-	sqe.UFlags = int32(POLLIN)
-	sqe.UserData = newConnInfo.id
-	commit()
+	if sqe != nil {
+		sqe.Opcode = PollAdd
+		sqe.Fd = int32(rc.fd)
+		sqe.UFlags = int32(POLLIN)
+		sqe.UserData = newConnInfo.id
+		commit()
+	}
 	ready := int32(1)
 	rc.pollReady = &ready
 	go rc.run()
 
 	// Add the old connection back as well.
 	sqe, commit = l.r.SubmitEntry()
-	sqe.Opcode = PollAdd
-	sqe.Fd = int32(cInfo.fd)
-	sqe.UFlags = int32(POLLIN)
-	sqe.UserData = uint64(cInfo.fd)
-	commit()
+	if sqe != nil {
+		sqe.Opcode = PollAdd
+		sqe.Fd = int32(cInfo.fd)
+		sqe.UFlags = int32(POLLIN)
+		sqe.UserData = uint64(cInfo.fd)
+		commit()
+	}
 
 	// Wait for the new connection to be accepted.
 	// TODO: If this is unbuffered it will block, alternatively it could be
 	// sent in a separate goroutine to ensure the main ring code isn't
 	// blocking.
-	l.newConn <- &rc
+	l.newConn <- rc
+}
+
+// newRingConn returns a ringConn for an accepted connection.
+func (l *ringListener) newRingConn(fd int, sa syscall.Sockaddr) *ringConn {
+	var offset int64
+	rc := &ringConn{
+		fd:     fd,
+		laddr:  l.a,
+		raddr:  &addr{net: l.a.net},
+		offset: &offset,
+		stop:   make(chan struct{}, 2),
+		poll:   make(chan uint64, 64),
+		closed: make(chan struct{}),
+		r:      l.r,
+	}
+	switch sockType := sa.(type) {
+	case *syscall.SockaddrInet4:
+		rc.raddr.s = fmt.Sprintf("%s:%d", net.IP(sockType.Addr[:]), sockType.Port)
+	case *syscall.SockaddrInet6:
+		rc.raddr.s = fmt.Sprintf("[%s]:%d", net.IP(sockType.Addr[:]), sockType.Port)
+	case *syscall.SockaddrUnix:
+		rc.raddr.s = sockType.Name
+	}
+	return rc
+}
+
+// runMultishot is used to accept connections using a multishot accept.
+func (l *ringListener) runMultishot(ms *Multishot) {
+	for {
+		select {
+		case <-l.stop:
+			if err := ms.Cancel(); err != nil && l.errHandler != nil {
+				l.errHandler(err)
+			}
+			// Drain the remaining completions so the ring isn't
+			// blocked.
+			for cqe := range ms.C {
+				if cqe.Res >= 0 {
+					syscall.Close(int(cqe.Res))
+				}
+			}
+			return
+		case cqe, ok := <-ms.C:
+			if !ok {
+				// The kernel terminated the request, arm a new
+				// one.
+				var err error
+				ms, err = l.r.AcceptMultishot(l.Fd(), syscall.SOCK_NONBLOCK)
+				if err != nil {
+					if l.errHandler != nil {
+						l.errHandler(err)
+					}
+					return
+				}
+				continue
+			}
+			if cqe.Res < 0 {
+				// The request is canceled when Accept isn't
+				// keeping up, it is rearmed once C is closed.
+				if syscall.Errno(-cqe.Res) != syscall.ECANCELED && l.errHandler != nil {
+					l.errHandler(syscall.Errno(-cqe.Res))
+				}
+				continue
+			}
+			fd := int(cqe.Res)
+			sa, err := syscall.Getpeername(fd)
+			if err != nil && l.errHandler != nil {
+				l.errHandler(err)
+			}
+			l.newConn <- l.newRingConn(fd, sa)
+		}
+	}
 }
 
 // Close implements the net.Listener interface.
@@ -264,32 +320,57 @@ func (l *ringListener) Fd() int {
 
 // SockoptListener returns a net.Listener that is Ring based.
 func (r *Ring) SockoptListener(network, address string, errHandler func(error), sockopts ...int) (net.Listener, error) {
-	var (
-		err      error
-		fd       int
-		sockAddr syscall.Sockaddr
-	)
+	fd, a, err := listenSocket(network, address, sockopts...)
+	if err != nil {
+		return nil, err
+	}
 	l := &ringListener{
 		r:          r,
-		a:          &addr{net: network},
+		a:          a,
 		stop:       make(chan struct{}),
 		newConn:    make(chan net.Conn, 1024),
 		connGet:    make(chan chan net.Conn),
 		errHandler: errHandler,
 	}
 
+	f := os.NewFile(uintptr(fd), "l")
+	l.f = f
+	l.debug = r.debug
+	if r.MultishotSupported(Accept) {
+		ms, err := r.AcceptMultishot(fd, syscall.SOCK_NONBLOCK)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		go l.runMultishot(ms)
+		return l, nil
+	}
+	go l.run()
+
+	return l, nil
+}
+
+// listenSocket returns a listening socket and its address.
+func listenSocket(network, address string, sockopts ...int) (int, *addr, error) {
+	var (
+		err      error
+		fd       int
+		sockAddr syscall.Sockaddr
+		a        = &addr{net: network}
+	)
+
 	switch network {
 	case "tcp", "tcp4":
 		fd, err = syscall.Socket(syscall.AF_INET, syscall.SOCK_STREAM, 0)
 		if err != nil {
-			return nil, fmt.Errorf("could not open socket")
+			return -1, nil, fmt.Errorf("could not open socket")
 		}
 		netAddr, err := net.ResolveTCPAddr(network, address)
 		if err != nil {
-			return nil, fmt.Errorf("could not open socket")
+			return -1, nil, fmt.Errorf("could not open socket")
 		}
-		l.a.net = netAddr.Network()
-		l.a.s = netAddr.String()
+		a.net = netAddr.Network()
+		a.s = netAddr.String()
 
 		var ipAddr [4]byte
 		copy(ipAddr[:], netAddr.IP)
@@ -300,14 +381,14 @@ func (r *Ring) SockoptListener(network, address string, errHandler func(error),
 	case "tcp6":
 		fd, err = syscall.Socket(syscall.AF_INET6, syscall.SOCK_STREAM, 0)
 		if err != nil {
-			return nil, fmt.Errorf("could not open socket")
+			return -1, nil, fmt.Errorf("could not open socket")
 		}
 		netAddr, err := net.ResolveTCPAddr(network, address)
 		if err != nil {
-			return nil, fmt.Errorf("could not open socket")
+			return -1, nil, fmt.Errorf("could not open socket")
 		}
-		l.a.net = netAddr.Network()
-		l.a.s = netAddr.String()
+		a.net = netAddr.Network()
+		a.s = netAddr.String()
 
 		ipAddr := [16]byte{}
 		copy(ipAddr[:], netAddr.IP)
@@ -323,11 +404,11 @@ func (r *Ring) SockoptListener(network, address string, errHandler func(error),
 	case "udp", "udp4":
 		fd, err = syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM, 0)
 		if err != nil {
-			return nil, fmt.Errorf("could not open socket")
+			return -1, nil, fmt.Errorf("could not open socket")
 		}
 		netAddr, err := net.ResolveUDPAddr(network, address)
 		if err != nil {
-			return nil, fmt.Errorf("could not open socket")
+			return -1, nil, fmt.Errorf("could not open socket")
 		}
 		ipAddr := [4]byte{}
 		copy(ipAddr[:], netAddr.IP)
@@ -338,14 +419,14 @@ func (r *Ring) SockoptListener(network, address string, errHandler func(error),
 	case "udp6":
 		fd, err = syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM, 0)
 		if err != nil {
-			return nil, fmt.Errorf("could not open socket")
+			return -1, nil, fmt.Errorf("could not open socket")
 		}
 		netAddr, err := net.ResolveUDPAddr(network, address)
 		if err != nil {
-			return nil, fmt.Errorf("could not open socket")
+			return -1, nil, fmt.Errorf("could not open socket")
 		}
-		l.a.net = netAddr.Network()
-		l.a.s = netAddr.String()
+		a.net = netAddr.Network()
+		a.s = netAddr.String()
 
 		ipAddr := [16]byte{}
 		copy(ipAddr[:], netAddr.IP)
@@ -354,11 +435,11 @@ func (r *Ring) SockoptListener(network, address string, errHandler func(error),
 			Addr: ipAddr,
 		}
 	default:
-		return nil, fmt.Errorf("unknown network family: %s", network)
+		return -1, nil, fmt.Errorf("unknown network family: %s", network)
 	}
 	if err != nil {
 		syscall.Close(fd)
-		return nil, err
+		return -1, nil, err
 	}
 
 	for _, sockopt := range sockopts {
@@ -366,34 +447,44 @@ func (r *Ring) SockoptListener(network, address string, errHandler func(error),
 			err = syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, sockopt, 1)
 			if err != nil {
 				syscall.Close(fd)
-				return nil, err
+				return -1, nil, err
 			}
 		} else if sockopt == TCPFastopen {
 			if err := FastOpenAllowed(); err != nil {
-				return nil, err
+				return -1, nil, err
 			}
 			err = syscall.SetsockoptInt(fd, syscall.SOL_TCP, sockopt, 1)
 			if err != nil {
 				syscall.Close(fd)
-				return nil, err
+				return -1, nil, err
 			}
 		}
 	}
 
 	if err := syscall.Bind(fd, sockAddr); err != nil {
 		syscall.Close(fd)
-		return nil, err
+		return -1, nil, err
 	}
 
 	if err := syscall.Listen(fd, syscall.SOMAXCONN); err != nil {
 		syscall.Close(fd)
-		return nil, err
+		return -1, nil, err
 	}
 
-	f := os.NewFile(uintptr(fd), "l")
-	l.f = f
-	l.debug = r.debug
-	go l.run()
+	// Update the address in case an ephemeral port was used.
+	sa, err := syscall.Getsockname(fd)
+	if err != nil {
+		syscall.Close(fd)
+		return -1, nil, err
+	}
+	switch sa := sa.(type) {
+	case *syscall.SockaddrInet4:
+		a.s = fmt.Sprintf("%s:%d", net.IP(sa.Addr[:]), sa.Port)
+	case *syscall.SockaddrInet6:
+		a.s = fmt.Sprintf("[%s]:%d", net.IP(sa.Addr[:]), sa.Port)
+	case *syscall.SockaddrUnix:
+		a.s = sa.Name
+	}
 
-	return l, nil
+	return fd, a, nil
 }
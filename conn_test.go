@@ -2,9 +2,11 @@ package iouring
 
 import (
 	"bytes"
+	"io"
 	"io/ioutil"
 	"net"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -40,3 +42,117 @@ func TestFastOpenAllowed(t *testing.T) {
 		require.Error(t, FastOpenAllowed())
 	}
 }
+
+func TestSockoptListenerMultishot(t *testing.T) {
+	r, err := New(8192, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	if !r.MultishotSupported(Accept) || !r.MultishotSupported(Recv) {
+		t.Skip("multishot accept and recv not supported")
+	}
+
+	l, err := r.SockoptListener("tcp", "127.0.0.1:9823", nil)
+	require.NoError(t, err)
+	require.NotNil(t, l)
+	defer l.Close()
+
+	go func() {
+		conn2, err := net.Dial("tcp", "127.0.0.1:9823")
+		require.NoError(t, err)
+		require.NotNil(t, conn2)
+		_, err = conn2.Write([]byte("multishot"))
+		require.NoError(t, err)
+		require.NoError(t, conn2.Close())
+	}()
+	conn, err := l.Accept()
+	require.NoError(t, err)
+	require.NotNil(t, conn)
+
+	b, err := ioutil.ReadAll(conn)
+	require.NoError(t, err)
+	require.Equal(t, "multishot", string(b))
+	require.NoError(t, conn.Close())
+}
+
+func TestRingConnCloseRead(t *testing.T) {
+	r, err := New(8192, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	if !r.MultishotSupported(Accept) || !r.MultishotSupported(Recv) {
+		t.Skip("multishot accept and recv not supported")
+	}
+
+	l, err := r.SockoptListener("tcp", "127.0.0.1:0", nil)
+	require.NoError(t, err)
+	require.NotNil(t, l)
+	defer l.Close()
+
+	conn2, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer conn2.Close()
+	conn, err := l.Accept()
+	require.NoError(t, err)
+	require.NotNil(t, conn)
+
+	_, err = conn2.Write([]byte("x"))
+	require.NoError(t, err)
+	b := make([]byte, 1)
+	_, err = conn.Read(b)
+	require.NoError(t, err)
+
+	// Close a connection with a reader that is waiting for data.
+	readErr := make(chan error, 1)
+	go func() {
+		_, err := conn.Read(b)
+		readErr <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, conn.Close())
+	require.Equal(t, errConnClosed, <-readErr)
+	require.Equal(t, errConnClosed, conn.Close())
+	_, err = conn.Read(b)
+	require.Equal(t, errConnClosed, err)
+}
+
+func TestRingConnSharedBuffers(t *testing.T) {
+	r, err := New(8192, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	if !r.MultishotSupported(Accept) || !r.MultishotSupported(Recv) {
+		t.Skip("multishot accept and recv not supported")
+	}
+
+	l, err := r.SockoptListener("tcp", "127.0.0.1:0", nil)
+	require.NoError(t, err)
+	require.NotNil(t, l)
+	defer l.Close()
+
+	var conns, peers [2]net.Conn
+	for i := range conns {
+		peers[i], err = net.Dial("tcp", l.Addr().String())
+		require.NoError(t, err)
+		defer peers[i].Close()
+		conns[i], err = l.Accept()
+		require.NoError(t, err)
+		_, err = peers[i].Write([]byte("x"))
+		require.NoError(t, err)
+		_, err = conns[i].Read(make([]byte, 1))
+		require.NoError(t, err)
+	}
+	// The connections of a ring receive into the same buffers.
+	bg := conns[0].(*ringConn).recv.bg
+	require.Equal(t, bg, conns[1].(*ringConn).recv.bg)
+
+	// Closing a connection with unread data returns its buffers.
+	_, err = peers[0].Write(bytes.Repeat([]byte("x"), 64*1024))
+	require.NoError(t, err)
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, conns[0].Close())
+
+	size := 2 * connRecvBuffers * connRecvBufferSize
+	go peers[1].Write(bytes.Repeat([]byte("y"), size))
+	n, err := io.ReadFull(conns[1], make([]byte, size))
+	require.NoError(t, err)
+	require.Equal(t, size, n)
+	require.NoError(t, conns[1].Close())
+}
@@ -27,6 +27,15 @@ const (
 	FeatSubmitStable   = (1 << 2)
 	FeatRwCurPos       = (1 << 3)
 	FeatCurPersonality = (1 << 4)
+	FeatFastPoll       = (1 << 5)
+	FeatPoll32Bits     = (1 << 6)
+	FeatSqpollNonfixed = (1 << 7)
+	FeatExtArg         = (1 << 8)
+	FeatNativeWorkers  = (1 << 9)
+	FeatRsrcTags       = (1 << 10)
+	FeatCqeSkip        = (1 << 11)
+	FeatLinkedFile     = (1 << 12)
+	FeatRegRegRing     = (1 << 13)
 )
 
 const (
@@ -69,6 +78,22 @@ const (
 	SetupClamp uint32 = (1 << 4)
 	// SetupAttachWq  attach to existing wq
 	SetupAttachWq uint32 = (1 << 5)
+	// SetupRDisabled start with the ring disabled
+	SetupRDisabled uint32 = (1 << 6)
+	// SetupSubmitAll continue submit on error
+	SetupSubmitAll uint32 = (1 << 7)
+	// SetupCoopTaskrun only run task work when the task enters the kernel
+	SetupCoopTaskrun uint32 = (1 << 8)
+	// SetupTaskrunFlag set SqTaskrun when there is task work pending
+	SetupTaskrunFlag uint32 = (1 << 9)
+	// SetupSQE128 SQEs are 128 bytes
+	SetupSQE128 uint32 = (1 << 10)
+	// SetupCQE32 CQEs are 32 bytes
+	SetupCQE32 uint32 = (1 << 11)
+	// SetupSingleIssuer only one task submits requests
+	SetupSingleIssuer uint32 = (1 << 12)
+	// SetupDeferTaskrun defer task work until GETEVENTS
+	SetupDeferTaskrun uint32 = (1 << 13)
 )
 
 const (
@@ -105,8 +130,67 @@ const (
 	Splice
 	ProvideBuffers
 	RemoveBuffers
+	Tee
+	Shutdown
+	RenameAt
+	UnlinkAt
+	MkdirAt
+	SymlinkAt
+	LinkAt
+	MsgRing
+	FSetXattr
+	SetXattr
+	FGetXattr
+	GetXattr
+	Socket
+	UringCmd
+	SendZC
+	SendMsgZC
+	ReadMultishot
+	WaitID
+	FutexWait
+	FutexWake
+	FutexWaitv
+	FixedFdInstall
 	OpSupported = (1 << 0)
 )
+
+const (
+	/*
+	 * cqe->flags
+	 */
+
+	// CqeFBuffer is set when the upper 16 bits of the flags are the buffer
+	// id.
+	CqeFBuffer uint32 = (1 << 0)
+	// CqeFMore is set when a multishot request will produce more
+	// completions.
+	CqeFMore uint32 = (1 << 1)
+	// CqeFSockNonempty is set when the socket has more data to read.
+	CqeFSockNonempty uint32 = (1 << 2)
+	// CqeFNotif is set on zero copy send notifications.
+	CqeFNotif uint32 = (1 << 3)
+	// CqeBufferShift is the shift of the buffer id in the flags.
+	CqeBufferShift = 16
+
+	/*
+	 * sqe->len poll flags
+	 */
+
+	// PollAddMulti is used for multishot polls.
+	PollAddMulti uint32 = (1 << 0)
+
+	/*
+	 * sqe->ioprio flags for accept and recv
+	 */
+
+	// AcceptMultishot is used for multishot accepts.
+	AcceptMultishot uint16 = (1 << 0)
+	// RecvsendPollFirst is used to poll before attempting a recv or send.
+	RecvsendPollFirst uint16 = (1 << 0)
+	// RecvMultishot is used for multishot receives.
+	RecvMultishot uint16 = (1 << 1)
+)
 const (
 	/*
 	 * sqe->fsync_flags
@@ -133,6 +217,8 @@ const (
 	// SqNeedWakeup needs io_uring_enter wakeup
 	SqNeedWakeup uint32 = (1 << 0)
 	SqCqOverflow uint32 = (1 << 1)
+	// SqTaskrun task work is pending
+	SqTaskrun uint32 = (1 << 2)
 
 	/*
 	 * io_uring_enter(2) flags
@@ -142,6 +228,9 @@ const (
 	EnterGetEvents uint = (1 << 0)
 	// EnterSqWakeup ...
 	EnterSqWakeup uint = (1 << 1)
+	// EnterRegisteredRing is used when the fd is the index of a registered
+	// ring fd.
+	EnterRegisteredRing uint = (1 << 4)
 
 	/*
 	 * io_uring_register(2) opcodes and arguments
@@ -158,6 +247,19 @@ const (
 	RegRegisterProbe         = 8
 	RegRegisterPersonality   = 9
 	RegUnregisterPersonality = 10
+	RegRegisterRestrictions  = 11
+	RegRegisterEnableRings   = 12
+	RegRegisterFiles2        = 13
+	RegRegisterFilesUpdate2  = 14
+	RegRegisterBuffers2      = 15
+	RegRegisterBuffersUpdate = 16
+	RegRegisterRingFds       = 20
+	RegUnregisterRingFds     = 21
+	RegRegisterPbufRing      = 22
+	RegUnregisterPbufRing    = 23
+
+	// RsrcRegisterSparse is used to register a table of empty slots.
+	RsrcRegisterSparse uint32 = (1 << 0)
 )
 
 // ReadWriteSeekerCloser is a ReadWriteCloser and ReadWriteSeeker.
@@ -0,0 +1,165 @@
+// +build linux
+
+package iouring
+
+import (
+	"syscall"
+	"unsafe"
+
+	"github.com/pkg/errors"
+)
+
+// errNoFileRegistry is returned when direct descriptors are used on a ring
+// without a FileRegistry.
+var errNoFileRegistry = errors.New("ring has no file registry, see WithFileRegistry")
+
+// WithFixedFile is used for requests on a direct descriptor, the fd of the
+// request is the slot in the registered file table.
+func WithFixedFile() OpOption {
+	return func(o *OpOptions) {
+		o.FixedFile = true
+	}
+}
+
+// allocSlot is used to allocate a slot for a direct descriptor. Kernels
+// without direct descriptors, which were added with mkdirat, would install
+// a file descriptor instead.
+func (r *Ring) allocSlot() (int, error) {
+	if r.fileReg == nil {
+		return -1, errNoFileRegistry
+	}
+	if !r.Supported(MkdirAt) {
+		return -1, ErrNotSupported
+	}
+	return r.fileReg.AllocSlot()
+}
+
+// waitSlot is used to wait for a request that installs a direct descriptor
+// in a slot, the slot is released if the request fails.
+func (r *Ring) waitSlot(id uint64, slot int) (int, error) {
+	if _, err := r.wait(id); err != nil {
+		r.fileReg.ReleaseSlot(slot)
+		return -1, err
+	}
+	return slot, nil
+}
+
+// PrepareAcceptDirect is used to prepare a SQE for an accept(2) call that
+// installs the connection in a slot of the registered file table.
+func (r *Ring) PrepareAcceptDirect(fd int, flags int, slot int, opts ...OpOption) (uint64, error) {
+	sqe, ready := r.SubmitEntry()
+	if sqe == nil {
+		return 0, errRingUnavailable
+	}
+
+	sqe.Opcode = Accept
+	sqe.UserData = r.ID()
+	sqe.Fd = int32(fd)
+	sqe.UFlags = int32(flags)
+	// The file index is one based.
+	setFileIndex(sqe, uint32(slot+1))
+
+	r.applyOpOptions(sqe, opts)
+	ready()
+	return sqe.UserData, nil
+}
+
+// AcceptDirect implements accept using a ring, the connection is installed
+// as a direct descriptor in a slot allocated from the FileRegistry and the
+// slot is returned. The flags must not include SOCK_CLOEXEC. Use WithFixedFile
+// for requests on the connection and CloseDirect to close it.
+func (r *Ring) AcceptDirect(fd int, flags int, opts ...OpOption) (int, error) {
+	slot, err := r.allocSlot()
+	if err != nil {
+		return -1, err
+	}
+	id, err := r.PrepareAcceptDirect(fd, flags, slot, opts...)
+	if err != nil {
+		r.fileReg.ReleaseSlot(slot)
+		return -1, err
+	}
+	return r.waitSlot(id, slot)
+}
+
+// PrepareOpenAtDirect is used to prepare a SQE for an openat(2) call that
+// installs the file in a slot of the registered file table.
+func (r *Ring) PrepareOpenAtDirect(
+	dirfd int,
+	path string,
+	flags int,
+	mode uint32,
+	slot int,
+	opts ...OpOption,
+) (uint64, error) {
+	sqe, ready := r.SubmitEntry()
+	if sqe == nil {
+		return 0, errRingUnavailable
+	}
+
+	sqe.Opcode = OpenAt
+	sqe.UserData = r.ID()
+	sqe.Fd = int32(dirfd)
+	b := cString(path)
+	r.pin(sqe.UserData, b)
+	sqe.Addr = (uint64)(uintptr(unsafe.Pointer(&b[0])))
+	sqe.Len = mode
+	sqe.UFlags = int32(flags)
+	setFileIndex(sqe, uint32(slot+1))
+
+	r.applyOpOptions(sqe, opts)
+	ready()
+	return sqe.UserData, nil
+}
+
+// OpenAtDirect implements openat using a ring, the file is installed as a
+// direct descriptor in a slot allocated from the FileRegistry and the slot is
+// returned. The flags must not include O_CLOEXEC.
+func (r *Ring) OpenAtDirect(dirfd int, path string, flags int, mode uint32, opts ...OpOption) (int, error) {
+	slot, err := r.allocSlot()
+	if err != nil {
+		return -1, err
+	}
+	id, err := r.PrepareOpenAtDirect(dirfd, path, flags, mode, slot, opts...)
+	if err != nil {
+		r.fileReg.ReleaseSlot(slot)
+		return -1, err
+	}
+	return r.waitSlot(id, slot)
+}
+
+// PrepareCloseDirect is used to prepare a SQE to close the direct descriptor
+// in a slot.
+func (r *Ring) PrepareCloseDirect(slot int, opts ...OpOption) (uint64, error) {
+	sqe, ready := r.SubmitEntry()
+	if sqe == nil {
+		return 0, errRingUnavailable
+	}
+	sqe.Opcode = Close
+	sqe.UserData = r.ID()
+	// The fd must be zero when closing a slot.
+	sqe.Fd = 0
+	setFileIndex(sqe, uint32(slot+1))
+
+	r.applyOpOptions(sqe, opts)
+	ready()
+	return sqe.UserData, nil
+}
+
+// CloseDirect is used to close a direct descriptor, the slot is released to
+// the FileRegistry once it is closed.
+func (r *Ring) CloseDirect(slot int, opts ...OpOption) error {
+	if r.fileReg == nil {
+		return errNoFileRegistry
+	}
+	id, err := r.PrepareCloseDirect(slot, opts...)
+	if err != nil {
+		return err
+	}
+	errno, _ := r.complete(id)
+	if errno < 0 {
+		// The slot may still hold a file.
+		return syscall.Errno(-errno)
+	}
+	r.fileReg.ReleaseSlot(slot)
+	return nil
+}
@@ -0,0 +1,111 @@
+// +build linux
+
+package iouring
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func readFixed(t *testing.T, r *Ring, slot int, b []byte) int {
+	id, err := r.PrepareRead(slot, b, 0, 0, WithFixedFile())
+	require.NoError(t, err)
+	n, err := r.wait(id)
+	require.NoError(t, err)
+	return int(n)
+}
+
+func TestOpenAtDirect(t *testing.T) {
+	r, err := New(2048, nil, WithFileRegistry())
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	defer r.Stop()
+
+	f, err := ioutil.TempFile("", "direct")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.Write([]byte("test"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	slot, err := r.OpenAtDirect(unix.AT_FDCWD, f.Name(), unix.O_RDONLY, 0)
+	if err == ErrNotSupported {
+		t.Skip(err)
+	}
+	require.NoError(t, err)
+	require.Equal(t, 0, slot)
+
+	b := make([]byte, 4)
+	require.Equal(t, 4, readFixed(t, r, slot, b))
+	require.Equal(t, "test", string(b))
+
+	require.NoError(t, r.CloseDirect(slot))
+	require.Equal(t, syscall.EBADF, r.CloseDirect(slot))
+
+	// The slot is reused.
+	slot2, err := r.OpenAtDirect(unix.AT_FDCWD, f.Name(), unix.O_RDONLY, 0)
+	require.NoError(t, err)
+	require.Equal(t, slot, slot2)
+	require.NoError(t, r.CloseDirect(slot2))
+
+	_, err = r.OpenAtDirect(unix.AT_FDCWD, f.Name()+".missing", unix.O_RDONLY, 0)
+	require.Equal(t, syscall.ENOENT, err)
+
+	// A slot isn't released when closing it fails.
+	slot, err = r.FileRegistry().AllocSlot()
+	require.NoError(t, err)
+	require.Equal(t, syscall.EBADF, r.CloseDirect(slot))
+	slot2, err = r.FileRegistry().AllocSlot()
+	require.NoError(t, err)
+	require.NotEqual(t, slot, slot2)
+}
+
+func TestAcceptDirect(t *testing.T) {
+	r, err := New(2048, nil, WithFileRegistry())
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	defer r.Stop()
+	requireOp(t, r, MkdirAt)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	lf, err := l.(*net.TCPListener).File()
+	require.NoError(t, err)
+	defer lf.Close()
+	require.NoError(t, unix.SetNonblock(int(lf.Fd()), false))
+
+	go func() {
+		c, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		c.Write([]byte("test"))
+		c.Read(make([]byte, 1))
+	}()
+
+	slot, err := r.AcceptDirect(int(lf.Fd()), 0)
+	require.NoError(t, err)
+	b := make([]byte, 4)
+	require.Equal(t, 4, readFixed(t, r, slot, b))
+	require.Equal(t, "test", string(b))
+	require.NoError(t, r.CloseDirect(slot))
+}
+
+func TestDirectNoFileRegistry(t *testing.T) {
+	r, err := New(8, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	defer r.Stop()
+
+	_, err = r.OpenAtDirect(unix.AT_FDCWD, "/", unix.O_RDONLY, 0)
+	require.Error(t, err)
+	require.Error(t, r.CloseDirect(0))
+}
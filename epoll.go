@@ -0,0 +1,76 @@
+// +build linux
+
+package iouring
+
+import (
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// PrepareEpollCtl is used to prepare a SQE for an epoll_ctl(2) call, the
+// event data is set to the file descriptor.
+func (r *Ring) PrepareEpollCtl(epfd int, op int, fd int, events uint32, opts ...OpOption) (uint64, error) {
+	sqe, ready := r.SubmitEntry()
+	if sqe == nil {
+		return 0, errRingUnavailable
+	}
+
+	sqe.Opcode = EpollCtl
+	sqe.UserData = r.ID()
+	sqe.Fd = int32(epfd)
+	sqe.Len = uint32(op)
+	sqe.Offset = uint64(fd)
+	ev := &unix.EpollEvent{Events: events, Fd: int32(fd)}
+	r.pin(sqe.UserData, ev)
+	sqe.Addr = (uint64)(uintptr(unsafe.Pointer(ev)))
+
+	r.applyOpOptions(sqe, opts)
+	ready()
+	return sqe.UserData, nil
+}
+
+// EpollCtl implements epoll_ctl using a ring.
+func (r *Ring) EpollCtl(epfd int, op int, fd int, events uint32, opts ...OpOption) error {
+	id, err := r.PrepareEpollCtl(epfd, op, fd, events, opts...)
+	if err != nil {
+		return err
+	}
+	errno, _ := r.complete(id)
+	if errno < 0 {
+		return syscall.Errno(-errno)
+	}
+	return nil
+}
+
+// EpollHandler is called by a Poller with the ready events of an epoll file
+// descriptor.
+type EpollHandler func(events []unix.EpollEvent)
+
+// AddEpoll is used to drive an existing epoll file descriptor from the
+// Poller. When the epoll fd is readable its ready events (up to maxEvents) are
+// collected without blocking and passed to the handler. Use Remove with the
+// epoll fd to stop polling it.
+func (p *Poller) AddEpoll(epfd int, maxEvents int, handler EpollHandler) error {
+	if maxEvents < 1 {
+		maxEvents = 1
+	}
+	buf := make([]unix.EpollEvent, maxEvents)
+	return p.Add(epfd, POLLIN, func(fd int, events int) {
+		if events&POLLIN == 0 {
+			return
+		}
+		for {
+			n, err := unix.EpollWait(fd, buf, 0)
+			if err == syscall.EINTR {
+				continue
+			}
+			if err != nil || n == 0 {
+				return
+			}
+			handler(buf[:n])
+			return
+		}
+	})
+}
@@ -0,0 +1,88 @@
+// +build linux
+
+package iouring
+
+import (
+	"context"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestRingEpollCtl(t *testing.T) {
+	r, err := New(2048, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+
+	epfd, err := unix.EpollCreate1(unix.EPOLL_CLOEXEC)
+	require.NoError(t, err)
+	defer unix.Close(epfd)
+
+	var fds [2]int
+	require.NoError(t, unix.Pipe(fds[:]))
+	defer unix.Close(fds[0])
+	defer unix.Close(fds[1])
+
+	require.NoError(t, r.EpollCtl(epfd, unix.EPOLL_CTL_ADD, fds[0], unix.EPOLLIN))
+	require.Equal(t, syscall.EEXIST, r.EpollCtl(epfd, unix.EPOLL_CTL_ADD, fds[0], unix.EPOLLIN))
+
+	_, err = unix.Write(fds[1], []byte("x"))
+	require.NoError(t, err)
+	events := make([]unix.EpollEvent, 4)
+	n, err := unix.EpollWait(epfd, events, 1000)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.Equal(t, int32(fds[0]), events[0].Fd)
+	require.NotZero(t, events[0].Events&unix.EPOLLIN)
+
+	require.NoError(t, r.EpollCtl(epfd, unix.EPOLL_CTL_DEL, fds[0], 0))
+	n, err = unix.EpollWait(epfd, events, 0)
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+	require.Equal(t, syscall.ENOENT, r.EpollCtl(epfd, unix.EPOLL_CTL_DEL, fds[0], 0))
+}
+
+func TestPollerAddEpoll(t *testing.T) {
+	r, err := New(2048, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+
+	epfd, err := unix.EpollCreate1(unix.EPOLL_CLOEXEC)
+	require.NoError(t, err)
+	defer unix.Close(epfd)
+
+	var fds [2]int
+	require.NoError(t, unix.Pipe(fds[:]))
+	defer unix.Close(fds[0])
+	defer unix.Close(fds[1])
+	require.NoError(t, r.EpollCtl(epfd, unix.EPOLL_CTL_ADD, fds[0], unix.EPOLLIN))
+
+	p := r.NewPoller()
+	defer p.Close()
+	ready := make(chan int32, 1)
+	require.NoError(t, p.AddEpoll(epfd, 8, func(events []unix.EpollEvent) {
+		for _, ev := range events {
+			// Consume the data so the epoll fd isn't readable.
+			unix.Read(int(ev.Fd), make([]byte, 16))
+			ready <- ev.Fd
+		}
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	go p.Run(ctx)
+
+	_, err = unix.Write(fds[1], []byte("x"))
+	require.NoError(t, err)
+	select {
+	case fd := <-ready:
+		require.Equal(t, int32(fds[0]), fd)
+	case <-ctx.Done():
+		t.Fatal("epoll event not delivered")
+	}
+
+	require.NoError(t, p.Remove(epfd))
+}
@@ -0,0 +1,81 @@
+// +build linux
+
+package iouring
+
+// FallocMode is the mode of a fallocate(2) call.
+type FallocMode uint32
+
+const (
+	/*
+	 * fallocate modes
+	 */
+
+	// FallocKeepSize allocates space without changing the file size.
+	FallocKeepSize FallocMode = 0x01
+	// FallocPunchHole deallocates a range, it must be used with
+	// FallocKeepSize.
+	FallocPunchHole FallocMode = 0x02
+	// FallocCollapseRange removes a range and shifts the rest of the file
+	// down.
+	FallocCollapseRange FallocMode = 0x08
+	// FallocZeroRange zeroes a range.
+	FallocZeroRange FallocMode = 0x10
+	// FallocInsertRange inserts a hole and shifts the rest of the file up.
+	FallocInsertRange FallocMode = 0x20
+	// FallocUnshareRange unshares shared blocks in a range.
+	FallocUnshareRange FallocMode = 0x40
+)
+
+// FileAllocator is used for managing the allocated space of a file. The
+// value returned by Ring.FileReadWriter implements FileAllocator.
+type FileAllocator interface {
+	// Allocate calls fallocate with the mode.
+	Allocate(mode FallocMode, offset int64, n int64) error
+	// Preallocate allocates space without changing the file size.
+	Preallocate(offset int64, n int64) error
+	// PunchHole deallocates a range, reads from the range return zeros.
+	PunchHole(offset int64, n int64) error
+	// ZeroRange zeroes a range, if keepSize is false the file is extended
+	// when the range is past the end of the file.
+	ZeroRange(offset int64, n int64, keepSize bool) error
+	// CollapseRange removes a range, the offset and length must be
+	// multiples of the filesystem block size.
+	CollapseRange(offset int64, n int64) error
+	// InsertRange inserts a hole, the offset and length must be multiples
+	// of the filesystem block size.
+	InsertRange(offset int64, n int64) error
+}
+
+// Allocate implements the FileAllocator interface.
+func (i *ringFIO) Allocate(mode FallocMode, offset int64, n int64) error {
+	return i.r.Fallocate(int(i.fd), uint32(mode), offset, n)
+}
+
+// Preallocate implements the FileAllocator interface.
+func (i *ringFIO) Preallocate(offset int64, n int64) error {
+	return i.Allocate(FallocKeepSize, offset, n)
+}
+
+// PunchHole implements the FileAllocator interface.
+func (i *ringFIO) PunchHole(offset int64, n int64) error {
+	return i.Allocate(FallocPunchHole|FallocKeepSize, offset, n)
+}
+
+// ZeroRange implements the FileAllocator interface.
+func (i *ringFIO) ZeroRange(offset int64, n int64, keepSize bool) error {
+	mode := FallocZeroRange
+	if keepSize {
+		mode |= FallocKeepSize
+	}
+	return i.Allocate(mode, offset, n)
+}
+
+// CollapseRange implements the FileAllocator interface.
+func (i *ringFIO) CollapseRange(offset int64, n int64) error {
+	return i.Allocate(FallocCollapseRange, offset, n)
+}
+
+// InsertRange implements the FileAllocator interface.
+func (i *ringFIO) InsertRange(offset int64, n int64) error {
+	return i.Allocate(FallocInsertRange, offset, n)
+}
@@ -0,0 +1,153 @@
+// +build linux
+
+package iouring
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	fallocBlock = 4096
+
+	// lseek(2) whence values, they aren't defined by x/sys/unix.
+	seekData = 3
+	seekHole = 4
+)
+
+// fallocDirs returns the directories to test fallocate modes in, the default
+// temp directory and tmpfs if it is available.
+func fallocDirs() []string {
+	dirs := []string{os.TempDir()}
+	if fi, err := os.Stat("/dev/shm"); err == nil && fi.IsDir() {
+		dirs = append(dirs, "/dev/shm")
+	}
+	return dirs
+}
+
+func newAllocFile(t *testing.T, r *Ring, dir string, blocks int) (*os.File, FileAllocator) {
+	f, err := ioutil.TempFile(dir, "falloc")
+	require.NoError(t, err)
+	_, err = f.Write(bytes.Repeat([]byte("a"), blocks*fallocBlock))
+	require.NoError(t, err)
+	rw, err := r.FileReadWriter(f)
+	require.NoError(t, err)
+	fa, ok := rw.(FileAllocator)
+	require.True(t, ok)
+	return f, fa
+}
+
+func seek(t *testing.T, f *os.File, offset int64, whence int) int64 {
+	off, err := unix.Seek(int(f.Fd()), offset, whence)
+	require.NoError(t, err)
+	return off
+}
+
+func fileSize(t *testing.T, f *os.File) int64 {
+	fi, err := f.Stat()
+	require.NoError(t, err)
+	return fi.Size()
+}
+
+func TestFilePunchHole(t *testing.T) {
+	r, err := New(2048, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+
+	for _, dir := range fallocDirs() {
+		f, fa := newAllocFile(t, r, dir, 4)
+		defer os.Remove(f.Name())
+
+		require.NoError(t, fa.PunchHole(fallocBlock, fallocBlock), dir)
+		require.Equal(t, int64(4*fallocBlock), fileSize(t, f), dir)
+		require.Equal(t, int64(fallocBlock), seek(t, f, 0, seekHole), dir)
+		require.Equal(t, int64(2*fallocBlock), seek(t, f, fallocBlock, seekData), dir)
+
+		b := make([]byte, fallocBlock)
+		_, err = f.ReadAt(b, fallocBlock)
+		require.NoError(t, err)
+		require.Equal(t, make([]byte, fallocBlock), b, dir)
+	}
+}
+
+func TestFileZeroRange(t *testing.T) {
+	r, err := New(2048, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+
+	for _, dir := range fallocDirs() {
+		f, fa := newAllocFile(t, r, dir, 2)
+		defer os.Remove(f.Name())
+
+		err := fa.ZeroRange(0, fallocBlock, true)
+		if err == syscall.EOPNOTSUPP {
+			continue
+		}
+		require.NoError(t, err, dir)
+		require.Equal(t, int64(2*fallocBlock), fileSize(t, f), dir)
+		b := make([]byte, fallocBlock)
+		_, err = f.ReadAt(b, 0)
+		require.NoError(t, err)
+		require.Equal(t, make([]byte, fallocBlock), b, dir)
+
+		require.NoError(t, fa.ZeroRange(2*fallocBlock, fallocBlock, false), dir)
+		require.Equal(t, int64(3*fallocBlock), fileSize(t, f), dir)
+	}
+}
+
+func TestFilePreallocate(t *testing.T) {
+	r, err := New(2048, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+
+	for _, dir := range fallocDirs() {
+		f, fa := newAllocFile(t, r, dir, 1)
+		defer os.Remove(f.Name())
+
+		require.NoError(t, fa.Preallocate(fallocBlock, 4*fallocBlock), dir)
+		require.Equal(t, int64(fallocBlock), fileSize(t, f), dir)
+		fi, err := f.Stat()
+		require.NoError(t, err)
+		// Blocks are in 512 byte units.
+		require.True(t, fi.Sys().(*syscall.Stat_t).Blocks >= 5*fallocBlock/512, dir)
+
+		require.NoError(t, fa.Allocate(0, 0, 2*fallocBlock), dir)
+		require.Equal(t, int64(2*fallocBlock), fileSize(t, f), dir)
+	}
+}
+
+func TestFileCollapseInsertRange(t *testing.T) {
+	r, err := New(2048, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+
+	for _, dir := range fallocDirs() {
+		f, fa := newAllocFile(t, r, dir, 4)
+		defer os.Remove(f.Name())
+
+		require.NoError(t, fa.PunchHole(fallocBlock, fallocBlock), dir)
+		err := fa.CollapseRange(fallocBlock, fallocBlock)
+		if err == syscall.EOPNOTSUPP {
+			// tmpfs doesn't support collapse and insert.
+			continue
+		}
+		require.NoError(t, err, dir)
+		require.Equal(t, int64(3*fallocBlock), fileSize(t, f), dir)
+		// The hole was removed.
+		require.Equal(t, int64(3*fallocBlock), seek(t, f, 0, seekHole), dir)
+
+		require.NoError(t, fa.InsertRange(0, fallocBlock), dir)
+		require.Equal(t, int64(4*fallocBlock), fileSize(t, f), dir)
+		require.Equal(t, int64(0), seek(t, f, 0, seekHole), dir)
+		require.Equal(t, int64(fallocBlock), seek(t, f, 0, seekData), dir)
+
+		// The range must be block aligned.
+		require.Equal(t, syscall.EINVAL, fa.InsertRange(1, fallocBlock), dir)
+	}
+}
@@ -0,0 +1,97 @@
+// +build linux
+
+package iouring
+
+// See linux/ioprio.h
+
+// IOPriorityClass is an IO scheduling class.
+type IOPriorityClass uint16
+
+const (
+	// IOPrioClassNone is used when no class has been set.
+	IOPrioClassNone IOPriorityClass = iota
+	// IOPrioClassRT is the real time scheduling class.
+	IOPrioClassRT
+	// IOPrioClassBE is the best effort scheduling class.
+	IOPrioClassBE
+	// IOPrioClassIdle is the idle scheduling class, requests are only
+	// served when no other IO is pending.
+	IOPrioClassIdle
+
+	ioprioClassShift = 13
+	ioprioLevelMask  = (1 << ioprioClassShift) - 1
+)
+
+// IOPriority is an encoded IO priority, see ioprio_set(2).
+type IOPriority uint16
+
+// NewIOPriority returns an IOPriority for a class and level, levels range
+// from 0 (highest) to 7 (lowest) for the RT and BE classes.
+func NewIOPriority(class IOPriorityClass, level int) IOPriority {
+	return IOPriority(uint16(class)<<ioprioClassShift | uint16(level)&ioprioLevelMask)
+}
+
+// Class returns the scheduling class of the priority.
+func (p IOPriority) Class() IOPriorityClass {
+	return IOPriorityClass(p >> ioprioClassShift)
+}
+
+// Level returns the level of the priority within its class.
+func (p IOPriority) Level() int {
+	return int(p & ioprioLevelMask)
+}
+
+// OpOptions are per request options that are applied to a SubmitEntry.
+type OpOptions struct {
+	// Priority is the IO priority of the request, the kernel only uses it
+	// for read and write requests.
+	Priority IOPriority
+	// Personality is the registered credentials the request runs with,
+	// zero uses the credentials of the ring.
+	Personality Personality
+	// FixedFile is set when the fd of the request is a direct descriptor.
+	FixedFile bool
+}
+
+// OpOption is used to configure a request.
+type OpOption func(*OpOptions)
+
+// WithIOPriority is used to set the IO priority of a request.
+func WithIOPriority(p IOPriority) OpOption {
+	return func(o *OpOptions) {
+		o.Priority = p
+	}
+}
+
+// usesIOPriority returns if the opcode uses the ioprio field as a priority,
+// other opcodes either ignore it or use it for flags.
+func usesIOPriority(op Opcode) bool {
+	switch op {
+	case Read, ReadFixed, Readv, Write, WriteFixed, Writev:
+		return true
+	default:
+		return false
+	}
+}
+
+// applyOpOptions is used to apply the ring defaults and request options to a
+// SubmitEntry.
+func (r *Ring) applyOpOptions(sqe *SubmitEntry, opts []OpOption) {
+	var o OpOptions
+	if usesIOPriority(sqe.Opcode) {
+		o.Priority = r.ioprio
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	// Other opcodes use the field for flags.
+	if o.Priority != 0 && usesIOPriority(sqe.Opcode) {
+		sqe.Ioprio = uint16(o.Priority)
+	}
+	if o.Personality != 0 {
+		setPersonality(sqe, o.Personality)
+	}
+	if o.FixedFile {
+		sqe.Flags |= SqeFixedFile
+	}
+}
@@ -0,0 +1,78 @@
+// +build linux
+
+package iouring
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIOPriority(t *testing.T) {
+	p := NewIOPriority(IOPrioClassBE, 4)
+	require.Equal(t, IOPrioClassBE, p.Class())
+	require.Equal(t, 4, p.Level())
+	require.Equal(t, IOPriority(2<<13|4), p)
+
+	p = NewIOPriority(IOPrioClassIdle, 0)
+	require.Equal(t, IOPrioClassIdle, p.Class())
+	require.Equal(t, 0, p.Level())
+}
+
+func TestApplyOpOptions(t *testing.T) {
+	idle := NewIOPriority(IOPrioClassIdle, 0)
+	rt := NewIOPriority(IOPrioClassRT, 0)
+	r, err := New(1024, nil, WithDefaultIOPriority(idle))
+	require.NoError(t, err)
+	require.NotNil(t, r)
+
+	sqe := &SubmitEntry{Opcode: Read}
+	r.applyOpOptions(sqe, nil)
+	require.Equal(t, uint16(idle), sqe.Ioprio)
+
+	sqe = &SubmitEntry{Opcode: Read}
+	r.applyOpOptions(sqe, []OpOption{WithIOPriority(rt)})
+	require.Equal(t, uint16(rt), sqe.Ioprio)
+
+	// The default is not applied to opcodes that use ioprio for flags.
+	sqe = &SubmitEntry{Opcode: Accept}
+	r.applyOpOptions(sqe, nil)
+	require.Zero(t, sqe.Ioprio)
+}
+
+func TestDefaultIOPriorityWrite(t *testing.T) {
+	var trace bytes.Buffer
+	prio := NewIOPriority(IOPrioClassBE, 7)
+	r, err := New(1024, nil, WithDefaultIOPriority(prio), WithRecorder(&trace))
+	require.NoError(t, err)
+	require.NotNil(t, r)
+
+	f, err := ioutil.TempFile("", "ioprio")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	rw, err := r.FileReadWriter(f)
+	require.NoError(t, err)
+	n, err := rw.Write([]byte("idle"))
+	require.NoError(t, err)
+	require.Equal(t, 4, n)
+
+	var writes int
+	tr := NewTraceReader(&trace)
+	for {
+		rec, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		if rec.SQE != nil && rec.SQE.Opcode == Write {
+			require.Equal(t, uint16(prio), rec.SQE.Ioprio)
+			writes++
+		}
+	}
+	require.Equal(t, 1, writes)
+}
@@ -0,0 +1,255 @@
+// +build linux
+
+package iouring
+
+const (
+	// cqeConsumed is used to mark CQEs that have been delivered to a
+	// multishot request but can't yet be consumed from the ring.
+	cqeConsumed = ^uint64(0)
+)
+
+// Multishot is a request that produces a completion for each event until it
+// completes or is canceled.
+type Multishot struct {
+	r  *Ring
+	id uint64
+	// C receives a CompletionEntry for each completion, it is closed after
+	// the final completion which doesn't have the CqeFMore flag set. The
+	// completions are buffered while C is full, when the buffer fills as
+	// well the request is canceled and the final completion has a result
+	// of -ECANCELED.
+	C <-chan CompletionEntry
+}
+
+// ID returns the user data of the request.
+func (m *Multishot) ID() uint64 {
+	return m.id
+}
+
+// Cancel is used to cancel the request, C is closed after the final
+// completion has been delivered.
+func (m *Multishot) Cancel() error {
+	return m.r.AsyncCancel(m.id, 0)
+}
+
+// BigMultishot is a Multishot whose completions include the extra data of a
+// ring that was setup with SetupCQE32.
+type BigMultishot struct {
+	r  *Ring
+	id uint64
+	// C receives a BigCompletionEntry for each completion, see
+	// Multishot.C.
+	C <-chan BigCompletionEntry
+}
+
+// ID returns the user data of the request.
+func (m *BigMultishot) ID() uint64 {
+	return m.id
+}
+
+// Cancel is used to cancel the request, C is closed after the final
+// completion has been delivered.
+func (m *BigMultishot) Cancel() error {
+	return m.r.AsyncCancel(m.id, 0)
+}
+
+// StreamBig is used to stream the completions of a multishot request that
+// was committed with SubmitEntry, the extra data is zero unless the ring was
+// setup with SetupCQE32. See WaitBig for single completions.
+func (r *Ring) StreamBig(id uint64) *BigMultishot {
+	c := make(chan BigCompletionEntry, r.cq.Len())
+	r.request(&completionRequest{
+		id:        id,
+		bigStream: c,
+	})
+	return &BigMultishot{r: r, id: id, C: c}
+}
+
+// multishot is used to commit a multishot SubmitEntry and stream its
+// completions.
+func (r *Ring) multishot(sqe *SubmitEntry, ready func(), opts []OpOption) *Multishot {
+	r.applyOpOptions(sqe, opts)
+	ready()
+	c := make(chan CompletionEntry, r.cq.Len())
+	r.request(&completionRequest{
+		id:     sqe.UserData,
+		stream: c,
+	})
+	return &Multishot{r: r, id: sqe.UserData, C: c}
+}
+
+// streamTo is used to deliver the completions of a request to a channel that
+// is shared by multiple requests.
+func (r *Ring) streamTo(id uint64, c chan CompletionEntry) {
+	r.request(&completionRequest{
+		id:     id,
+		stream: c,
+		shared: true,
+	})
+}
+
+// AcceptMultishot is used to accept connections on a listening socket until
+// the request is canceled, the result of each completion is the file
+// descriptor of the connection.
+func (r *Ring) AcceptMultishot(fd int, flags int, opts ...OpOption) (*Multishot, error) {
+	if !r.MultishotSupported(Accept) {
+		return nil, ErrNotSupported
+	}
+	sqe, ready := r.SubmitEntry()
+	if sqe == nil {
+		return nil, errRingUnavailable
+	}
+
+	sqe.Opcode = Accept
+	sqe.UserData = r.ID()
+	sqe.Fd = int32(fd)
+	sqe.UFlags = int32(flags)
+	sqe.Ioprio = AcceptMultishot
+
+	return r.multishot(sqe, ready, opts), nil
+}
+
+// PollMultishot is used to poll a file descriptor until the request is
+// canceled, the result of each completion is the mask of ready events.
+func (r *Ring) PollMultishot(fd int, mask int, opts ...OpOption) (*Multishot, error) {
+	if !r.MultishotSupported(PollAdd) {
+		return nil, ErrNotSupported
+	}
+	sqe, ready := r.SubmitEntry()
+	if sqe == nil {
+		return nil, errRingUnavailable
+	}
+
+	sqe.Opcode = PollAdd
+	sqe.UserData = r.ID()
+	sqe.Fd = int32(fd)
+	sqe.UFlags = int32(mask)
+	sqe.Len = PollAddMulti
+
+	return r.multishot(sqe, ready, opts), nil
+}
+
+// RecvMultishot is used to receive from a socket until the request is
+// canceled or the buffer group is exhausted. Each completion uses a buffer
+// from the group, the buffer id is in the upper bits of the flags (see
+// CqeBufferShift) and the result is the number of bytes received.
+func (r *Ring) RecvMultishot(fd int, group uint16, flags int, opts ...OpOption) (*Multishot, error) {
+	if !r.MultishotSupported(Recv) {
+		return nil, ErrNotSupported
+	}
+	sqe, ready := r.SubmitEntry()
+	if sqe == nil {
+		return nil, errRingUnavailable
+	}
+
+	sqe.Opcode = Recv
+	sqe.UserData = r.ID()
+	sqe.Fd = int32(fd)
+	sqe.UFlags = int32(flags)
+	sqe.Flags = SqeBufferSelect
+	sqe.Ioprio = RecvMultishot
+	setBufGroup(sqe, group)
+
+	return r.multishot(sqe, ready, opts), nil
+}
+
+// deliver is used to send a completion to a stream without blocking the ring,
+// completions are buffered while the stream is full. When as many completions
+// are buffered as the stream holds the request is canceled.
+func (r *Ring) deliver(inflight map[uint64]*completionRequest, cr *completionRequest, cqe BigCompletionEntry) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	if len(cr.backlog) == 0 && cr.trySend(cqe) {
+		if cqe.Flags&CqeFMore == 0 {
+			cr.closeStream()
+		}
+		return
+	}
+	cr.backlog = append(cr.backlog, cqe)
+	if len(cr.backlog) == 1 {
+		go cr.flush()
+	}
+	if !cr.canceled && cqe.Flags&CqeFMore != 0 && len(cr.backlog) >= cr.streamCap() {
+		cr.canceled = r.cancelStream(inflight, cr.id)
+	}
+}
+
+// cancelStream is used to cancel a request from the goroutine that reaps
+// completions, the cancellation is reaped with the inflight requests. It
+// returns false if the SubmitQueue is full.
+func (r *Ring) cancelStream(inflight map[uint64]*completionRequest, id uint64) bool {
+	sqe := r.nextEntry()
+	if sqe == nil {
+		return false
+	}
+	sqe.Opcode = AsyncCancel
+	sqe.UserData = r.ID()
+	sqe.Fd = -1
+	sqe.Addr = id
+	inflight[sqe.UserData] = &completionRequest{
+		id:   sqe.UserData,
+		done: make(chan struct{}, 1),
+	}
+	r.commitEntry(sqe)
+	return true
+}
+
+// flush is used to send the buffered completions of a stream, it runs until
+// the buffer is empty.
+func (cr *completionRequest) flush() {
+	cr.mu.Lock()
+	for len(cr.backlog) > 0 {
+		cqe := cr.backlog[0]
+		cr.mu.Unlock()
+		if cr.bigStream != nil {
+			cr.bigStream <- cqe
+		} else {
+			cr.stream <- cqe.CompletionEntry
+		}
+		if cqe.Flags&CqeFMore == 0 {
+			cr.closeStream()
+		}
+		cr.mu.Lock()
+		cr.backlog = cr.backlog[1:]
+	}
+	cr.mu.Unlock()
+}
+
+// trySend is used to send a completion if the stream isn't full.
+func (cr *completionRequest) trySend(cqe BigCompletionEntry) bool {
+	if cr.bigStream != nil {
+		select {
+		case cr.bigStream <- cqe:
+			return true
+		default:
+			return false
+		}
+	}
+	select {
+	case cr.stream <- cqe.CompletionEntry:
+		return true
+	default:
+		return false
+	}
+}
+
+// streamCap returns the capacity of the stream.
+func (cr *completionRequest) streamCap() int {
+	n := cap(cr.stream)
+	if cr.bigStream != nil {
+		n = cap(cr.bigStream)
+	}
+	if n == 0 {
+		return 1
+	}
+	return n
+}
+
+// closeStream is used to close the stream after the final completion.
+func (cr *completionRequest) closeStream() {
+	if cr.bigStream != nil {
+		close(cr.bigStream)
+	} else if !cr.shared {
+		close(cr.stream)
+	}
+}
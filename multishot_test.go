@@ -0,0 +1,213 @@
+// +build linux
+
+package iouring
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestPollMultishot(t *testing.T) {
+	r, err := New(2048, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	if !r.MultishotSupported(PollAdd) {
+		t.Skip("multishot poll not supported")
+	}
+
+	var fds [2]int
+	require.NoError(t, syscall.Pipe(fds[:]))
+	defer syscall.Close(fds[0])
+	defer syscall.Close(fds[1])
+
+	ms, err := r.PollMultishot(fds[0], POLLIN)
+	require.NoError(t, err)
+
+	buf := make([]byte, 1)
+	for i := 0; i < 3; i++ {
+		_, err = syscall.Write(fds[1], []byte{byte(i)})
+		require.NoError(t, err)
+		cqe := <-ms.C
+		require.True(t, cqe.Res&POLLIN != 0)
+		require.True(t, cqe.Flags&CqeFMore != 0)
+		_, err = syscall.Read(fds[0], buf)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, ms.Cancel())
+	var last CompletionEntry
+	for cqe := range ms.C {
+		last = cqe
+	}
+	require.Zero(t, last.Flags&CqeFMore)
+	require.Equal(t, int32(-int32(syscall.ECANCELED)), last.Res)
+}
+
+func TestMultishotOverflow(t *testing.T) {
+	r, err := New(4, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	if !r.MultishotSupported(PollAdd) {
+		t.Skip("multishot poll not supported")
+	}
+
+	efd, err := unix.Eventfd(0, unix.EFD_NONBLOCK)
+	require.NoError(t, err)
+	defer syscall.Close(efd)
+
+	ms, err := r.PollMultishot(efd, POLLIN)
+	require.NoError(t, err)
+
+	// Each write completes the poll, C isn't drained so the request is
+	// canceled instead of blocking the other requests.
+	for i := 0; i < 8*int(r.CQ().Len()); i++ {
+		_, err = syscall.Write(efd, []byte{1, 0, 0, 0, 0, 0, 0, 0})
+		require.NoError(t, err)
+		done := make(chan error, 1)
+		go func() {
+			done <- r.Nop()
+		}()
+		select {
+		case err := <-done:
+			require.NoError(t, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("ring blocked on a full stream")
+		}
+	}
+
+	var (
+		n    int
+		last CompletionEntry
+	)
+	for cqe := range ms.C {
+		last = cqe
+		n++
+	}
+	require.True(t, n > int(r.CQ().Len()))
+	require.Zero(t, last.Flags&CqeFMore)
+	require.Equal(t, -int32(syscall.ECANCELED), last.Res)
+}
+
+func TestAcceptMultishot(t *testing.T) {
+	r, err := New(2048, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	if !r.MultishotSupported(Accept) {
+		t.Skip("multishot accept not supported")
+	}
+
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_STREAM, 0)
+	require.NoError(t, err)
+	defer syscall.Close(fd)
+	require.NoError(t, syscall.Bind(fd, &syscall.SockaddrInet4{Addr: [4]byte{127, 0, 0, 1}}))
+	require.NoError(t, syscall.Listen(fd, 16))
+	sa, err := syscall.Getsockname(fd)
+	require.NoError(t, err)
+
+	ms, err := r.AcceptMultishot(fd, 0)
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		c, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_STREAM, 0)
+		require.NoError(t, err)
+		require.NoError(t, syscall.Connect(c, sa))
+		cqe := <-ms.C
+		require.True(t, cqe.Res > 0)
+		require.True(t, cqe.Flags&CqeFMore != 0)
+		syscall.Close(int(cqe.Res))
+		syscall.Close(c)
+	}
+
+	require.NoError(t, ms.Cancel())
+	for range ms.C {
+	}
+}
+
+func TestRecvMultishot(t *testing.T) {
+	r, err := New(2048, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	if !r.MultishotSupported(Recv) {
+		t.Skip("multishot recv not supported")
+	}
+
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	require.NoError(t, err)
+	defer syscall.Close(fds[0])
+	defer syscall.Close(fds[1])
+
+	bg, err := r.NewBufferGroup(4, 64)
+	require.NoError(t, err)
+	ms, err := r.RecvMultishot(fds[0], bg.ID(), 0)
+	require.NoError(t, err)
+
+	for _, msg := range []string{"hello", "world"} {
+		_, err = syscall.Write(fds[1], []byte(msg))
+		require.NoError(t, err)
+		cqe := <-ms.C
+		require.Equal(t, int32(len(msg)), cqe.Res)
+		bid, ok := CqeBufferID(&cqe)
+		require.True(t, ok)
+		require.Equal(t, msg, string(bg.Buffer(bid)[:cqe.Res]))
+		require.NoError(t, bg.Release(bid))
+	}
+
+	require.NoError(t, ms.Cancel())
+	for range ms.C {
+	}
+	require.NoError(t, bg.Close())
+}
+
+func TestStreamBig(t *testing.T) {
+	r, err := New(8, nil, WithCQE32())
+	if errors.Cause(err) == ErrNotSupported {
+		t.Skip(err)
+	}
+	require.NoError(t, err)
+	defer r.Stop()
+	if !r.MultishotSupported(PollAdd) {
+		t.Skip("multishot poll not supported")
+	}
+
+	var fds [2]int
+	require.NoError(t, syscall.Pipe(fds[:]))
+	defer syscall.Close(fds[0])
+	defer syscall.Close(fds[1])
+
+	sqe, ready := r.SubmitEntry()
+	require.NotNil(t, sqe)
+	sqe.Opcode = PollAdd
+	sqe.UserData = r.ID()
+	sqe.Fd = int32(fds[0])
+	sqe.UFlags = int32(POLLIN)
+	sqe.Len = PollAddMulti
+	ready()
+	ms := r.StreamBig(sqe.UserData)
+
+	// Wrap around the completion queue.
+	buf := make([]byte, 1)
+	for i := 0; i < 2*int(r.cq.Len()); i++ {
+		_, err = syscall.Write(fds[1], []byte{byte(i)})
+		require.NoError(t, err)
+		cqe := <-ms.C
+		require.Equal(t, ms.ID(), cqe.UserData)
+		require.True(t, cqe.Res&POLLIN != 0)
+		require.True(t, cqe.Flags&CqeFMore != 0)
+		require.Equal(t, [2]uint64{}, cqe.Big)
+		_, err = syscall.Read(fds[0], buf)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, ms.Cancel())
+	var last BigCompletionEntry
+	for cqe := range ms.C {
+		last = cqe
+	}
+	require.Zero(t, last.Flags&CqeFMore)
+	require.Equal(t, int32(-int32(syscall.ECANCELED)), last.Res)
+}
@@ -22,6 +22,7 @@ func (r *Ring) PrepareAccept(
 	addr syscall.Sockaddr,
 	socklen uint32,
 	flags int,
+	opts ...OpOption,
 ) (uint64, error) {
 	sqe, ready := r.SubmitEntry()
 	if sqe == nil {
@@ -35,12 +36,13 @@ func (r *Ring) PrepareAccept(
 	sqe.Offset = uint64(socklen)
 	sqe.UFlags = int32(flags)
 
+	r.applyOpOptions(sqe, opts)
 	ready()
 	return sqe.UserData, nil
 }
 
 // PrepareClose is used to prepare a close(2) call.
-func (r *Ring) PrepareClose(fd int) (uint64, error) {
+func (r *Ring) PrepareClose(fd int, opts ...OpOption) (uint64, error) {
 	sqe, ready := r.SubmitEntry()
 	if sqe == nil {
 		return 0, errRingUnavailable
@@ -49,13 +51,14 @@ func (r *Ring) PrepareClose(fd int) (uint64, error) {
 	sqe.UserData = r.ID()
 	sqe.Fd = int32(fd)
 
+	r.applyOpOptions(sqe, opts)
 	ready()
 	return sqe.UserData, nil
 }
 
 // Close is implements close(2).
-func (r *Ring) Close(fd int) error {
-	id, err := r.PrepareClose(fd)
+func (r *Ring) Close(fd int, opts ...OpOption) error {
+	id, err := r.PrepareClose(fd, opts...)
 	if err != nil {
 		return err
 	}
@@ -71,6 +74,7 @@ func (r *Ring) PrepareConnect(
 	fd int,
 	addr syscall.Sockaddr,
 	socklen uint32,
+	opts ...OpOption,
 ) (uint64, error) {
 	sqe, ready := r.SubmitEntry()
 	if sqe == nil {
@@ -83,13 +87,14 @@ func (r *Ring) PrepareConnect(
 	sqe.Addr = (uint64)(uintptr(unsafe.Pointer(&addr)))
 	sqe.Len = socklen
 
+	r.applyOpOptions(sqe, opts)
 	ready()
 	return sqe.UserData, nil
 }
 
 // PrepareFadvise is used to prepare a fadvise call.
 func (r *Ring) PrepareFadvise(
-	fd int, offset uint64, n uint32, advise int) (uint64, error) {
+	fd int, offset uint64, n uint32, advise int, opts ...OpOption) (uint64, error) {
 	sqe, ready := r.SubmitEntry()
 	if sqe == nil {
 		return 0, errRingUnavailable
@@ -102,13 +107,48 @@ func (r *Ring) PrepareFadvise(
 	sqe.Offset = offset
 	sqe.UFlags = int32(advise)
 
+	r.applyOpOptions(sqe, opts)
 	ready()
 	return sqe.UserData, nil
 }
 
 // Fadvise implements fadvise.
-func (r *Ring) Fadvise(fd int, offset uint64, n uint32, advise int) error {
-	id, err := r.PrepareFadvise(fd, offset, n, advise)
+func (r *Ring) Fadvise(fd int, offset uint64, n uint32, advise int, opts ...OpOption) error {
+	id, err := r.PrepareFadvise(fd, offset, n, advise, opts...)
+	if err != nil {
+		return err
+	}
+	errno, _ := r.complete(id)
+	if errno < 0 {
+		return syscall.Errno(-errno)
+	}
+	return nil
+}
+
+// PrepareMadvise is used to prepare a madvise call, the buffer must be page
+// aligned.
+func (r *Ring) PrepareMadvise(b []byte, advice int, opts ...OpOption) (uint64, error) {
+	sqe, ready := r.SubmitEntry()
+	if sqe == nil {
+		return 0, errRingUnavailable
+	}
+
+	sqe.Opcode = Madvise
+	sqe.UserData = r.ID()
+	sqe.Fd = -1
+	r.pin(sqe.UserData, b)
+	sqe.Addr = (uint64)(uintptr(unsafe.Pointer(&b[0])))
+	sqe.Len = uint32(len(b))
+	sqe.UFlags = int32(advice)
+
+	r.applyOpOptions(sqe, opts)
+	ready()
+	return sqe.UserData, nil
+}
+
+// Madvise implements madvise.
+func (r *Ring) Madvise(b []byte, advice int, opts ...OpOption) error {
+	id, err := r.PrepareMadvise(b, advice, opts...)
 	if err != nil {
 		return err
 	}
@@ -121,7 +161,7 @@ func (r *Ring) Fadvise(fd int, offset uint64, n uint32, advise int) error {
 
 // PrepareFallocate is used to prepare a fallocate call.
 func (r *Ring) PrepareFallocate(
-	fd int, mode uint32, offset int64, n int64) (uint64, error) {
+	fd int, mode uint32, offset int64, n int64, opts ...OpOption) (uint64, error) {
 	sqe, ready := r.SubmitEntry()
 	if sqe == nil {
 		return 0, errRingUnavailable
@@ -134,13 +174,14 @@ func (r *Ring) PrepareFallocate(
 	sqe.Len = mode
 	sqe.Offset = uint64(offset)
 
+	r.applyOpOptions(sqe, opts)
 	ready()
 	return sqe.UserData, nil
 }
 
 // Fallocate implements fallocate.
-func (r *Ring) Fallocate(fd int, mode uint32, offset int64, n int64) error {
-	id, err := r.PrepareFallocate(fd, mode, offset, n)
+func (r *Ring) Fallocate(fd int, mode uint32, offset int64, n int64, opts ...OpOption) error {
+	id, err := r.PrepareFallocate(fd, mode, offset, n, opts...)
 	if err != nil {
 		return err
 	}
@@ -152,7 +193,7 @@ func (r *Ring) Fallocate(fd int, mode uint32, offset int64, n int64) error {
 }
 
 // PrepareFsync is used to prepare a fsync(2) call.
-func (r *Ring) PrepareFsync(fd int, flags int) (uint64, error) {
+func (r *Ring) PrepareFsync(fd int, flags int, opts ...OpOption) (uint64, error) {
 	sqe, ready := r.SubmitEntry()
 	if sqe == nil {
 		return 0, errRingUnavailable
@@ -162,13 +203,14 @@ func (r *Ring) PrepareFsync(fd int, flags int) (uint64, error) {
 	sqe.Fd = int32(fd)
 	sqe.UFlags = int32(flags)
 
+	r.applyOpOptions(sqe, opts)
 	ready()
 	return sqe.UserData, nil
 }
 
 // Fsync implements fsync(2).
-func (r *Ring) Fsync(fd int, flags int) error {
-	id, err := r.PrepareFsync(fd, flags)
+func (r *Ring) Fsync(fd int, flags int, opts ...OpOption) error {
+	id, err := r.PrepareFsync(fd, flags, opts...)
 	if err != nil {
 		return err
 	}
@@ -180,7 +222,7 @@ func (r *Ring) Fsync(fd int, flags int) error {
 }
 
 // PrepareNop is used to prep a nop.
-func (r *Ring) PrepareNop() (uint64, error) {
+func (r *Ring) PrepareNop(opts ...OpOption) (uint64, error) {
 	sqe, ready := r.SubmitEntry()
 	if sqe == nil {
 		return 0, errRingUnavailable
@@ -189,13 +231,14 @@ func (r *Ring) PrepareNop() (uint64, error) {
 	sqe.UserData = r.ID()
 	sqe.Fd = -1
 
+	r.applyOpOptions(sqe, opts)
 	ready()
 	return sqe.UserData, nil
 }
 
 // Nop is a nop.
-func (r *Ring) Nop() error {
-	id, err := r.PrepareNop()
+func (r *Ring) Nop(opts ...OpOption) error {
+	id, err := r.PrepareNop(opts...)
 	if err != nil {
 		return err
 	}
@@ -207,8 +250,8 @@ func (r *Ring) Nop() error {
 }
 
 // PollAdd is used to add a poll to a fd.
-func (r *Ring) PollAdd(fd int, mask int) error {
-	id, err := r.PreparePollAdd(fd, mask)
+func (r *Ring) PollAdd(fd int, mask int, opts ...OpOption) error {
+	id, err := r.PreparePollAdd(fd, mask, opts...)
 	if err != nil {
 		return err
 	}
@@ -220,7 +263,7 @@ func (r *Ring) PollAdd(fd int, mask int) error {
 }
 
 // PreparePollAdd is used to prepare a SQE for adding a poll.
-func (r *Ring) PreparePollAdd(fd int, mask int) (uint64, error) {
+func (r *Ring) PreparePollAdd(fd int, mask int, opts ...OpOption) (uint64, error) {
 	sqe, ready := r.SubmitEntry()
 	if sqe == nil {
 		return 0, errRingUnavailable
@@ -230,15 +273,87 @@ func (r *Ring) PreparePollAdd(fd int, mask int) (uint64, error) {
 	sqe.UFlags = int32(mask)
 	sqe.UserData = r.ID()
 
+	r.applyOpOptions(sqe, opts)
+	ready()
+	return sqe.UserData, nil
+}
+
+// PollRemove is used to remove the poll with the given user data.
+func (r *Ring) PollRemove(data uint64, opts ...OpOption) error {
+	id, err := r.PreparePollRemove(data, opts...)
+	if err != nil {
+		return err
+	}
+	errno, _ := r.complete(id)
+	if errno < 0 {
+		return syscall.Errno(-errno)
+	}
+	return nil
+}
+
+// PreparePollRemove is used to prepare a SQE for removing the poll with the
+// given user data.
+func (r *Ring) PreparePollRemove(data uint64, opts ...OpOption) (uint64, error) {
+	sqe, ready := r.SubmitEntry()
+	if sqe == nil {
+		return 0, errRingUnavailable
+	}
+	sqe.Opcode = PollRemove
+	sqe.Fd = -1
+	sqe.Addr = data
+	sqe.UserData = r.ID()
+
+	r.applyOpOptions(sqe, opts)
 	ready()
 	return sqe.UserData, nil
 }
 
+// PrepareOpenAt is used to prepare a SQE for an openat(2) call.
+func (r *Ring) PrepareOpenAt(
+	dirfd int,
+	path string,
+	flags int,
+	mode uint32,
+	opts ...OpOption,
+) (uint64, error) {
+	sqe, ready := r.SubmitEntry()
+	if sqe == nil {
+		return 0, errRingUnavailable
+	}
+
+	sqe.Opcode = OpenAt
+	sqe.UserData = r.ID()
+	sqe.Fd = int32(dirfd)
+	b := cString(path)
+	r.pin(sqe.UserData, b)
+	sqe.Addr = (uint64)(uintptr(unsafe.Pointer(&b[0])))
+	sqe.Len = mode
+	sqe.UFlags = int32(flags)
+
+	r.applyOpOptions(sqe, opts)
+	ready()
+	return sqe.UserData, nil
+}
+
+// OpenAt implements openat using a ring, it returns the file descriptor.
+func (r *Ring) OpenAt(dirfd int, path string, flags int, mode uint32, opts ...OpOption) (int, error) {
+	id, err := r.PrepareOpenAt(dirfd, path, flags, mode, opts...)
+	if err != nil {
+		return -1, err
+	}
+	errno, _ := r.complete(id)
+	if errno < 0 {
+		return -1, syscall.Errno(-errno)
+	}
+	return int(errno), nil
+}
+
 // PrepareReadv is used to prepare a readv SQE.
 func (r *Ring) PrepareReadv(
 	fd int,
 	iovecs []*syscall.Iovec,
 	offset int,
+	opts ...OpOption,
 ) (uint64, error) {
 	sqe, ready := r.SubmitEntry()
 	if sqe == nil {
@@ -252,6 +367,7 @@ func (r *Ring) PrepareReadv(
 	sqe.Len = uint32(len(iovecs))
 	sqe.Offset = uint64(offset)
 
+	r.applyOpOptions(sqe, opts)
 	ready()
 	return sqe.UserData, nil
 }
@@ -261,6 +377,7 @@ func (r *Ring) PrepareRecvmsg(
 	fd int,
 	msg *syscall.Msghdr,
 	flags int,
+	opts ...OpOption,
 ) (uint64, error) {
 	sqe, ready := r.SubmitEntry()
 	if sqe == nil {
@@ -275,6 +392,7 @@ func (r *Ring) PrepareRecvmsg(
 	sqe.Offset = 0
 	sqe.UFlags = int32(flags)
 
+	r.applyOpOptions(sqe, opts)
 	ready()
 	return sqe.UserData, nil
 }
@@ -287,8 +405,9 @@ func (r *Ring) Splice(
 	outOff *int64,
 	n int,
 	flags int,
+	opts ...OpOption,
 ) (int64, error) {
-	id, err := r.PrepareSplice(inFd, inOff, outFd, outOff, n, flags)
+	id, err := r.PrepareSplice(inFd, inOff, outFd, outOff, n, flags, opts...)
 	if err != nil {
 		return 0, err
 	}
@@ -310,6 +429,7 @@ func (r *Ring) PrepareSplice(
 	outOff *int64,
 	n int,
 	flags int,
+	opts ...OpOption,
 ) (uint64, error) {
 	sqe, ready := r.SubmitEntry()
 	if sqe == nil {
@@ -336,6 +456,7 @@ func (r *Ring) PrepareSplice(
 	sqe.Anon0 = anon
 	sqe.UserData = r.ID()
 
+	r.applyOpOptions(sqe, opts)
 	ready()
 	return sqe.UserData, nil
 }
@@ -347,8 +468,9 @@ func (r *Ring) Statx(
 	flags int,
 	mask int,
 	statx *unix.Statx_t,
+	opts ...OpOption,
 ) (err error) {
-	id, err := r.PrepareStatx(dirfd, path, flags, mask, statx)
+	id, err := r.PrepareStatx(dirfd, path, flags, mask, statx, opts...)
 	if err != nil {
 		return err
 	}
@@ -374,6 +496,7 @@ func (r *Ring) PrepareStatx(
 	flags int,
 	mask int,
 	statx *unix.Statx_t,
+	opts ...OpOption,
 ) (uint64, error) {
 	sqe, ready := r.SubmitEntry()
 	if sqe == nil {
@@ -382,23 +505,24 @@ func (r *Ring) PrepareStatx(
 
 	sqe.Opcode = Statx
 	sqe.Fd = int32(dirfd)
-	if path != "" {
-		// TODO: could probably avoid the conversion to []byte
-		b := saferStringToBytes(&path)
-		sqe.Addr = (uint64)(uintptr(unsafe.Pointer(&b[0])))
-	}
+	sqe.UserData = r.ID()
+	// The kernel expects a NUL terminated path, it is pinned until the
+	// completion is reaped.
+	b := cString(path)
+	r.pin(sqe.UserData, b)
+	sqe.Addr = (uint64)(uintptr(unsafe.Pointer(&b[0])))
 	sqe.Len = uint32(mask)
 	sqe.Offset = (uint64)(uintptr(unsafe.Pointer(statx)))
 	sqe.UFlags = int32(flags)
-	sqe.UserData = r.ID()
 
+	r.applyOpOptions(sqe, opts)
 	ready()
 	return sqe.UserData, nil
 }
 
 // PrepareTimeout is used to prepare a timeout SQE.
 func (r *Ring) PrepareTimeout(
-	ts *syscall.Timespec, count int, flags int) (uint64, error) {
+	ts *syscall.Timespec, count int, flags int, opts ...OpOption) (uint64, error) {
 	sqe, ready := r.SubmitEntry()
 	if sqe == nil {
 		return 0, errRingUnavailable
@@ -412,12 +536,29 @@ func (r *Ring) PrepareTimeout(
 	sqe.Len = 1
 	sqe.Offset = uint64(count)
 
+	r.applyOpOptions(sqe, opts)
 	ready()
 	return sqe.UserData, nil
 }
 
+// Timeout is used to wait for the timeout to expire or for count completions,
+// the timespec is relative unless the TimeoutAbs flag is set.
+func (r *Ring) Timeout(ts *syscall.Timespec, count int, flags int, opts ...OpOption) error {
+	id, err := r.PrepareTimeout(ts, count, flags, opts...)
+	if err != nil {
+		return err
+	}
+	errno, _ := r.complete(id)
+	runtime.KeepAlive(ts)
+	// An expired timeout completes with ETIME.
+	if errno < 0 && syscall.Errno(-errno) != syscall.ETIME {
+		return syscall.Errno(-errno)
+	}
+	return nil
+}
+
 // PrepareTimeoutRemove is used to prepare a timeout removal.
-func (r *Ring) PrepareTimeoutRemove(data uint64, flags int) (uint64, error) {
+func (r *Ring) PrepareTimeoutRemove(data uint64, flags int, opts ...OpOption) (uint64, error) {
 	sqe, ready := r.SubmitEntry()
 	if sqe == nil {
 		return 0, errRingUnavailable
@@ -431,16 +572,31 @@ func (r *Ring) PrepareTimeoutRemove(data uint64, flags int) (uint64, error) {
 	sqe.Len = 0
 	sqe.Offset = 0
 
+	r.applyOpOptions(sqe, opts)
 	ready()
 	return sqe.UserData, nil
 }
 
+// TimeoutRemove is used to remove the timeout with the given user data.
+func (r *Ring) TimeoutRemove(data uint64, flags int, opts ...OpOption) error {
+	id, err := r.PrepareTimeoutRemove(data, flags, opts...)
+	if err != nil {
+		return err
+	}
+	errno, _ := r.complete(id)
+	if errno < 0 {
+		return syscall.Errno(-errno)
+	}
+	return nil
+}
+
 // PrepareRead is used to prepare a read SQE.
 func (r *Ring) PrepareRead(
 	fd int,
 	b []byte,
 	offset uint64,
 	flags uint8,
+	opts ...OpOption,
 ) (uint64, error) {
 	sqe, ready := r.SubmitEntry()
 	if sqe == nil {
@@ -455,6 +611,7 @@ func (r *Ring) PrepareRead(
 	sqe.Offset = offset
 	sqe.Addr = (uint64)(uintptr(unsafe.Pointer(&b[0])))
 
+	r.applyOpOptions(sqe, opts)
 	ready()
 	return sqe.UserData, nil
 }
@@ -464,6 +621,7 @@ func (r *Ring) PrepareReadFixed(
 	fd int,
 	b []byte,
 	flags uint8,
+	opts ...OpOption,
 ) (uint64, error) {
 	sqe, ready := r.SubmitEntry()
 	if sqe == nil {
@@ -477,6 +635,7 @@ func (r *Ring) PrepareReadFixed(
 	sqe.Flags = flags
 	sqe.Addr = (uint64)(uintptr(unsafe.Pointer(&b[0])))
 
+	r.applyOpOptions(sqe, opts)
 	ready()
 	return sqe.UserData, nil
 }
@@ -487,6 +646,7 @@ func (r *Ring) PrepareWrite(
 	b []byte,
 	offset uint64,
 	flags uint8,
+	opts ...OpOption,
 ) (uint64, error) {
 	sqe, ready := r.SubmitEntry()
 	if sqe == nil {
@@ -501,6 +661,7 @@ func (r *Ring) PrepareWrite(
 	sqe.Offset = offset
 	sqe.Addr = (uint64)(uintptr(unsafe.Pointer(&b[0])))
 
+	r.applyOpOptions(sqe, opts)
 	ready()
 	return sqe.UserData, nil
 }
@@ -510,6 +671,7 @@ func (r *Ring) PrepareWriteFixed(
 	fd int,
 	b []byte,
 	flags uint8,
+	opts ...OpOption,
 ) (uint64, error) {
 	sqe, ready := r.SubmitEntry()
 	if sqe == nil {
@@ -523,6 +685,7 @@ func (r *Ring) PrepareWriteFixed(
 	sqe.Flags = flags
 	sqe.Addr = (uint64)(uintptr(unsafe.Pointer(&b[0])))
 
+	r.applyOpOptions(sqe, opts)
 	ready()
 	return sqe.UserData, nil
 }
@@ -532,6 +695,7 @@ func (r *Ring) PrepareWritev(
 	fd int,
 	iovecs []*syscall.Iovec,
 	offset int,
+	opts ...OpOption,
 ) (uint64, error) {
 	sqe, ready := r.SubmitEntry()
 	if sqe == nil {
@@ -545,6 +709,7 @@ func (r *Ring) PrepareWritev(
 	sqe.Len = uint32(len(iovecs))
 	sqe.Offset = uint64(offset)
 
+	r.applyOpOptions(sqe, opts)
 	ready()
 	return sqe.UserData, nil
 }
@@ -554,6 +719,7 @@ func (r *Ring) PrepareSend(
 	fd int,
 	b []byte,
 	flags uint8,
+	opts ...OpOption,
 ) (uint64, error) {
 	sqe, ready := r.SubmitEntry()
 	if sqe == nil {
@@ -567,6 +733,7 @@ func (r *Ring) PrepareSend(
 	sqe.Flags = flags
 	sqe.Addr = (uint64)(uintptr(unsafe.Pointer(&b[0])))
 
+	r.applyOpOptions(sqe, opts)
 	ready()
 	return sqe.UserData, nil
 }
@@ -576,8 +743,9 @@ func (r *Ring) Send(
 	fd int,
 	b []byte,
 	flags uint8,
+	opts ...OpOption,
 ) error {
-	id, err := r.PrepareSend(fd, b, flags)
+	id, err := r.PrepareSend(fd, b, flags, opts...)
 	if err != nil {
 		return err
 	}
@@ -595,6 +763,7 @@ func (r *Ring) PrepareRecv(
 	fd int,
 	b []byte,
 	flags uint8,
+	opts ...OpOption,
 ) (uint64, error) {
 	sqe, ready := r.SubmitEntry()
 	if sqe == nil {
@@ -608,6 +777,7 @@ func (r *Ring) PrepareRecv(
 	sqe.Flags = flags
 	sqe.Addr = (uint64)(uintptr(unsafe.Pointer(&b[0])))
 
+	r.applyOpOptions(sqe, opts)
 	ready()
 	return sqe.UserData, nil
 }
@@ -617,8 +787,9 @@ func (r *Ring) Recv(
 	fd int,
 	b []byte,
 	flags uint8,
+	opts ...OpOption,
 ) error {
-	id, err := r.PrepareRecv(fd, b, flags)
+	id, err := r.PrepareRecv(fd, b, flags, opts...)
 	if err != nil {
 		return err
 	}
@@ -630,3 +801,35 @@ func (r *Ring) Recv(
 	}
 	return nil
 }
+
+// PrepareAsyncCancel is used to prepare a SQE to cancel the request with the
+// given user data.
+func (r *Ring) PrepareAsyncCancel(data uint64, flags int, opts ...OpOption) (uint64, error) {
+	sqe, ready := r.SubmitEntry()
+	if sqe == nil {
+		return 0, errRingUnavailable
+	}
+
+	sqe.Opcode = AsyncCancel
+	sqe.UserData = r.ID()
+	sqe.UFlags = int32(flags)
+	sqe.Fd = -1
+	sqe.Addr = data
+
+	r.applyOpOptions(sqe, opts)
+	ready()
+	return sqe.UserData, nil
+}
+
+// AsyncCancel is used to cancel the request with the given user data.
+func (r *Ring) AsyncCancel(data uint64, flags int, opts ...OpOption) error {
+	id, err := r.PrepareAsyncCancel(data, flags, opts...)
+	if err != nil {
+		return err
+	}
+	errno, _ := r.complete(id)
+	if errno < 0 {
+		return syscall.Errno(-errno)
+	}
+	return nil
+}
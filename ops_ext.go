@@ -0,0 +1,655 @@
+// +build linux
+
+package iouring
+
+import (
+	"encoding/binary"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	// MsgRingData is the MsgRing command to post a CQE to another ring.
+	MsgRingData = 0
+
+	// FixedFdNoCloexec is used to install a fixed file without O_CLOEXEC.
+	FixedFdNoCloexec = (1 << 0)
+
+	// Futex2SizeU32 is the futex2 flag for a 32 bit futex.
+	Futex2SizeU32 = 0x02
+	// Futex2Private is the futex2 flag for a process private futex.
+	Futex2Private = 128
+	// FutexBitsetMatchAny is the futex mask that matches any waiter.
+	FutexBitsetMatchAny = 0xffffffff
+
+	/*
+	 * waitid id types
+	 */
+
+	// PAll waits for any child.
+	PAll = 0
+	// PPid waits for the child with the pid.
+	PPid = 1
+	// PPgid waits for any child in the process group.
+	PPgid = 2
+	// PPidfd waits for the child referred to by the pidfd.
+	PPidfd = 3
+)
+
+// WaitIDInfo is the siginfo_t that is filled in by WaitID for a child state
+// change.
+type WaitIDInfo struct {
+	Signo  int32
+	Errno  int32
+	Code   int32
+	_      int32
+	Pid    int32
+	UID    uint32
+	Status int32
+	_      [100]byte
+}
+
+// extEntry is used to get a SubmitEntry for an opcode that isn't supported by
+// all kernels.
+func (r *Ring) extEntry(op Opcode) (*SubmitEntry, func(), error) {
+	if !r.Supported(op) {
+		return nil, nil, ErrNotSupported
+	}
+	sqe, ready := r.SubmitEntry()
+	if sqe == nil {
+		return nil, nil, errRingUnavailable
+	}
+	sqe.Opcode = op
+	sqe.UserData = r.ID()
+	return sqe, ready, nil
+}
+
+// wait is used to wait for a request and return its result.
+func (r *Ring) wait(id uint64) (int32, error) {
+	res, _ := r.complete(id)
+	if res < 0 {
+		return 0, syscall.Errno(-res)
+	}
+	return res, nil
+}
+
+// setAddr3 is used to set the addr3 union member of the SQE.
+func setAddr3(sqe *SubmitEntry, addr uint64) {
+	binary.LittleEndian.PutUint64(sqe.Anon0[8:16], addr)
+}
+
+// setFileIndex is used to set the splice_fd_in/file_index union member of
+// the SQE.
+func setFileIndex(sqe *SubmitEntry, v uint32) {
+	binary.LittleEndian.PutUint32(sqe.Anon0[4:8], v)
+}
+
+// pinPaths is used to pin NUL terminated copies of paths to the request and
+// returns their addresses.
+func (r *Ring) pinPaths(sqe *SubmitEntry, paths ...string) []uint64 {
+	addrs := make([]uint64, len(paths))
+	bufs := make([][]byte, len(paths))
+	for i, path := range paths {
+		bufs[i] = cString(path)
+		addrs[i] = (uint64)(uintptr(unsafe.Pointer(&bufs[i][0])))
+	}
+	r.pin(sqe.UserData, bufs)
+	return addrs
+}
+
+// PrepareTee is used to prepare a SQE for a tee(2) call.
+func (r *Ring) PrepareTee(inFd int, outFd int, n int, flags int, opts ...OpOption) (uint64, error) {
+	sqe, ready, err := r.extEntry(Tee)
+	if err != nil {
+		return 0, err
+	}
+
+	sqe.Fd = int32(outFd)
+	sqe.Len = uint32(n)
+	sqe.UFlags = int32(flags)
+	setFileIndex(sqe, uint32(inFd))
+
+	r.applyOpOptions(sqe, opts)
+	ready()
+	return sqe.UserData, nil
+}
+
+// Tee implements tee using a ring.
+func (r *Ring) Tee(inFd int, outFd int, n int, flags int, opts ...OpOption) (int64, error) {
+	id, err := r.PrepareTee(inFd, outFd, n, flags, opts...)
+	if err != nil {
+		return 0, err
+	}
+	res, err := r.wait(id)
+	return int64(res), err
+}
+
+// PrepareShutdown is used to prepare a SQE for a shutdown(2) call.
+func (r *Ring) PrepareShutdown(fd int, how int, opts ...OpOption) (uint64, error) {
+	sqe, ready, err := r.extEntry(Shutdown)
+	if err != nil {
+		return 0, err
+	}
+
+	sqe.Fd = int32(fd)
+	sqe.Len = uint32(how)
+
+	r.applyOpOptions(sqe, opts)
+	ready()
+	return sqe.UserData, nil
+}
+
+// Shutdown implements shutdown using a ring.
+func (r *Ring) Shutdown(fd int, how int, opts ...OpOption) error {
+	id, err := r.PrepareShutdown(fd, how, opts...)
+	if err != nil {
+		return err
+	}
+	_, err = r.wait(id)
+	return err
+}
+
+// PrepareRenameAt is used to prepare a SQE for a renameat2(2) call.
+func (r *Ring) PrepareRenameAt(
+	oldDirfd int,
+	oldPath string,
+	newDirfd int,
+	newPath string,
+	flags int,
+	opts ...OpOption,
+) (uint64, error) {
+	sqe, ready, err := r.extEntry(RenameAt)
+	if err != nil {
+		return 0, err
+	}
+
+	addrs := r.pinPaths(sqe, oldPath, newPath)
+	sqe.Fd = int32(oldDirfd)
+	sqe.Addr = addrs[0]
+	sqe.Len = uint32(newDirfd)
+	sqe.Offset = addrs[1]
+	sqe.UFlags = int32(flags)
+
+	r.applyOpOptions(sqe, opts)
+	ready()
+	return sqe.UserData, nil
+}
+
+// RenameAt implements renameat2 using a ring.
+func (r *Ring) RenameAt(
+	oldDirfd int,
+	oldPath string,
+	newDirfd int,
+	newPath string,
+	flags int,
+	opts ...OpOption,
+) error {
+	id, err := r.PrepareRenameAt(oldDirfd, oldPath, newDirfd, newPath, flags, opts...)
+	if err != nil {
+		return err
+	}
+	_, err = r.wait(id)
+	return err
+}
+
+// PrepareUnlinkAt is used to prepare a SQE for an unlinkat(2) call.
+func (r *Ring) PrepareUnlinkAt(dirfd int, path string, flags int, opts ...OpOption) (uint64, error) {
+	sqe, ready, err := r.extEntry(UnlinkAt)
+	if err != nil {
+		return 0, err
+	}
+
+	sqe.Fd = int32(dirfd)
+	sqe.Addr = r.pinPaths(sqe, path)[0]
+	sqe.UFlags = int32(flags)
+
+	r.applyOpOptions(sqe, opts)
+	ready()
+	return sqe.UserData, nil
+}
+
+// UnlinkAt implements unlinkat using a ring.
+func (r *Ring) UnlinkAt(dirfd int, path string, flags int, opts ...OpOption) error {
+	id, err := r.PrepareUnlinkAt(dirfd, path, flags, opts...)
+	if err != nil {
+		return err
+	}
+	_, err = r.wait(id)
+	return err
+}
+
+// PrepareMkdirAt is used to prepare a SQE for a mkdirat(2) call.
+func (r *Ring) PrepareMkdirAt(dirfd int, path string, mode uint32, opts ...OpOption) (uint64, error) {
+	sqe, ready, err := r.extEntry(MkdirAt)
+	if err != nil {
+		return 0, err
+	}
+
+	sqe.Fd = int32(dirfd)
+	sqe.Addr = r.pinPaths(sqe, path)[0]
+	sqe.Len = mode
+
+	r.applyOpOptions(sqe, opts)
+	ready()
+	return sqe.UserData, nil
+}
+
+// MkdirAt implements mkdirat using a ring.
+func (r *Ring) MkdirAt(dirfd int, path string, mode uint32, opts ...OpOption) error {
+	id, err := r.PrepareMkdirAt(dirfd, path, mode, opts...)
+	if err != nil {
+		return err
+	}
+	_, err = r.wait(id)
+	return err
+}
+
+// PrepareSymlinkAt is used to prepare a SQE for a symlinkat(2) call.
+func (r *Ring) PrepareSymlinkAt(target string, newDirfd int, linkPath string, opts ...OpOption) (uint64, error) {
+	sqe, ready, err := r.extEntry(SymlinkAt)
+	if err != nil {
+		return 0, err
+	}
+
+	addrs := r.pinPaths(sqe, target, linkPath)
+	sqe.Fd = int32(newDirfd)
+	sqe.Addr = addrs[0]
+	sqe.Offset = addrs[1]
+
+	r.applyOpOptions(sqe, opts)
+	ready()
+	return sqe.UserData, nil
+}
+
+// SymlinkAt implements symlinkat using a ring.
+func (r *Ring) SymlinkAt(target string, newDirfd int, linkPath string, opts ...OpOption) error {
+	id, err := r.PrepareSymlinkAt(target, newDirfd, linkPath, opts...)
+	if err != nil {
+		return err
+	}
+	_, err = r.wait(id)
+	return err
+}
+
+// PrepareLinkAt is used to prepare a SQE for a linkat(2) call.
+func (r *Ring) PrepareLinkAt(
+	oldDirfd int,
+	oldPath string,
+	newDirfd int,
+	newPath string,
+	flags int,
+	opts ...OpOption,
+) (uint64, error) {
+	sqe, ready, err := r.extEntry(LinkAt)
+	if err != nil {
+		return 0, err
+	}
+
+	addrs := r.pinPaths(sqe, oldPath, newPath)
+	sqe.Fd = int32(oldDirfd)
+	sqe.Addr = addrs[0]
+	sqe.Len = uint32(newDirfd)
+	sqe.Offset = addrs[1]
+	sqe.UFlags = int32(flags)
+
+	r.applyOpOptions(sqe, opts)
+	ready()
+	return sqe.UserData, nil
+}
+
+// LinkAt implements linkat using a ring.
+func (r *Ring) LinkAt(
+	oldDirfd int,
+	oldPath string,
+	newDirfd int,
+	newPath string,
+	flags int,
+	opts ...OpOption,
+) error {
+	id, err := r.PrepareLinkAt(oldDirfd, oldPath, newDirfd, newPath, flags, opts...)
+	if err != nil {
+		return err
+	}
+	_, err = r.wait(id)
+	return err
+}
+
+// PrepareMsgRing is used to prepare a SQE that posts a CQE with the result
+// and user data to the ring with the file descriptor ringFd.
+func (r *Ring) PrepareMsgRing(ringFd int, res int32, data uint64, flags int, opts ...OpOption) (uint64, error) {
+	sqe, ready, err := r.extEntry(MsgRing)
+	if err != nil {
+		return 0, err
+	}
+
+	sqe.Fd = int32(ringFd)
+	sqe.Addr = MsgRingData
+	sqe.Len = uint32(res)
+	sqe.Offset = data
+	sqe.UFlags = int32(flags)
+
+	r.applyOpOptions(sqe, opts)
+	ready()
+	return sqe.UserData, nil
+}
+
+// MsgRing is used to post a CQE with the result and user data to the ring
+// with the file descriptor ringFd.
+func (r *Ring) MsgRing(ringFd int, res int32, data uint64, flags int, opts ...OpOption) error {
+	id, err := r.PrepareMsgRing(ringFd, res, data, flags, opts...)
+	if err != nil {
+		return err
+	}
+	_, err = r.wait(id)
+	return err
+}
+
+// prepareXattr is used to prepare the xattr opcodes, path is only used for
+// the path based opcodes.
+func (r *Ring) prepareXattr(
+	op Opcode,
+	fd int,
+	path string,
+	name string,
+	value []byte,
+	flags int,
+	opts []OpOption,
+) (uint64, error) {
+	sqe, ready, err := r.extEntry(op)
+	if err != nil {
+		return 0, err
+	}
+
+	bufs := [][]byte{cString(name), cString(path), value}
+	r.pin(sqe.UserData, bufs)
+	sqe.Fd = int32(fd)
+	sqe.Addr = (uint64)(uintptr(unsafe.Pointer(&bufs[0][0])))
+	if len(value) > 0 {
+		sqe.Offset = (uint64)(uintptr(unsafe.Pointer(&value[0])))
+	}
+	sqe.Len = uint32(len(value))
+	sqe.UFlags = int32(flags)
+	if op == SetXattr || op == GetXattr {
+		setAddr3(sqe, (uint64)(uintptr(unsafe.Pointer(&bufs[1][0]))))
+	}
+
+	r.applyOpOptions(sqe, opts)
+	ready()
+	return sqe.UserData, nil
+}
+
+// PrepareFSetXattr is used to prepare a SQE for a fsetxattr(2) call.
+func (r *Ring) PrepareFSetXattr(fd int, name string, value []byte, flags int, opts ...OpOption) (uint64, error) {
+	return r.prepareXattr(FSetXattr, fd, "", name, value, flags, opts)
+}
+
+// FSetXattr implements fsetxattr using a ring.
+func (r *Ring) FSetXattr(fd int, name string, value []byte, flags int, opts ...OpOption) error {
+	id, err := r.PrepareFSetXattr(fd, name, value, flags, opts...)
+	if err != nil {
+		return err
+	}
+	_, err = r.wait(id)
+	runtime.KeepAlive(value)
+	return err
+}
+
+// PrepareSetXattr is used to prepare a SQE for a setxattr(2) call.
+func (r *Ring) PrepareSetXattr(path string, name string, value []byte, flags int, opts ...OpOption) (uint64, error) {
+	return r.prepareXattr(SetXattr, 0, path, name, value, flags, opts)
+}
+
+// SetXattr implements setxattr using a ring.
+func (r *Ring) SetXattr(path string, name string, value []byte, flags int, opts ...OpOption) error {
+	id, err := r.PrepareSetXattr(path, name, value, flags, opts...)
+	if err != nil {
+		return err
+	}
+	_, err = r.wait(id)
+	runtime.KeepAlive(value)
+	return err
+}
+
+// PrepareFGetXattr is used to prepare a SQE for a fgetxattr(2) call.
+func (r *Ring) PrepareFGetXattr(fd int, name string, value []byte, opts ...OpOption) (uint64, error) {
+	return r.prepareXattr(FGetXattr, fd, "", name, value, 0, opts)
+}
+
+// FGetXattr implements fgetxattr using a ring, it returns the size of the
+// value.
+func (r *Ring) FGetXattr(fd int, name string, value []byte, opts ...OpOption) (int, error) {
+	id, err := r.PrepareFGetXattr(fd, name, value, opts...)
+	if err != nil {
+		return 0, err
+	}
+	res, err := r.wait(id)
+	runtime.KeepAlive(value)
+	return int(res), err
+}
+
+// PrepareGetXattr is used to prepare a SQE for a getxattr(2) call.
+func (r *Ring) PrepareGetXattr(path string, name string, value []byte, opts ...OpOption) (uint64, error) {
+	return r.prepareXattr(GetXattr, 0, path, name, value, 0, opts)
+}
+
+// GetXattr implements getxattr using a ring, it returns the size of the
+// value.
+func (r *Ring) GetXattr(path string, name string, value []byte, opts ...OpOption) (int, error) {
+	id, err := r.PrepareGetXattr(path, name, value, opts...)
+	if err != nil {
+		return 0, err
+	}
+	res, err := r.wait(id)
+	runtime.KeepAlive(value)
+	return int(res), err
+}
+
+// PrepareSocket is used to prepare a SQE for a socket(2) call.
+func (r *Ring) PrepareSocket(domain int, typ int, proto int, opts ...OpOption) (uint64, error) {
+	sqe, ready, err := r.extEntry(Socket)
+	if err != nil {
+		return 0, err
+	}
+
+	sqe.Fd = int32(domain)
+	sqe.Offset = uint64(typ)
+	sqe.Len = uint32(proto)
+
+	r.applyOpOptions(sqe, opts)
+	ready()
+	return sqe.UserData, nil
+}
+
+// Socket implements socket using a ring, it returns the file descriptor of
+// the socket.
+func (r *Ring) Socket(domain int, typ int, proto int, opts ...OpOption) (int, error) {
+	id, err := r.PrepareSocket(domain, typ, proto, opts...)
+	if err != nil {
+		return -1, err
+	}
+	res, err := r.wait(id)
+	if err != nil {
+		return -1, err
+	}
+	return int(res), nil
+}
+
+// SendZC is used to send data to a socket without copying it, the buffer is
+// pinned until the kernel posts the notification that it is no longer used.
+// The returned Multishot receives the send result followed by the
+// notification (with the CqeFNotif flag set).
+func (r *Ring) SendZC(fd int, b []byte, flags int, opts ...OpOption) (*Multishot, error) {
+	sqe, ready, err := r.extEntry(SendZC)
+	if err != nil {
+		return nil, err
+	}
+
+	r.pin(sqe.UserData, b)
+	sqe.Fd = int32(fd)
+	sqe.Addr = (uint64)(uintptr(unsafe.Pointer(&b[0])))
+	sqe.Len = uint32(len(b))
+	sqe.UFlags = int32(flags)
+
+	return r.multishot(sqe, ready, opts), nil
+}
+
+// SendZCWait is used to send data to a socket without copying it, it returns
+// after the kernel is done with the buffer.
+func (r *Ring) SendZCWait(fd int, b []byte, flags int, opts ...OpOption) (int, error) {
+	ms, err := r.SendZC(fd, b, flags, opts...)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for cqe := range ms.C {
+		if cqe.Flags&CqeFNotif != 0 {
+			continue
+		}
+		if cqe.Res < 0 {
+			err = syscall.Errno(-cqe.Res)
+			continue
+		}
+		n = int(cqe.Res)
+	}
+	return n, err
+}
+
+// PrepareWaitID is used to prepare a SQE for a waitid(2) call.
+func (r *Ring) PrepareWaitID(
+	idType int,
+	id int,
+	info *WaitIDInfo,
+	options int,
+	opts ...OpOption,
+) (uint64, error) {
+	sqe, ready, err := r.extEntry(WaitID)
+	if err != nil {
+		return 0, err
+	}
+
+	sqe.Fd = int32(id)
+	sqe.Len = uint32(idType)
+	if info != nil {
+		r.pin(sqe.UserData, info)
+		sqe.Offset = (uint64)(uintptr(unsafe.Pointer(info)))
+	}
+	setFileIndex(sqe, uint32(options))
+
+	r.applyOpOptions(sqe, opts)
+	ready()
+	return sqe.UserData, nil
+}
+
+// WaitID implements waitid using a ring.
+func (r *Ring) WaitID(idType int, id int, info *WaitIDInfo, options int, opts ...OpOption) error {
+	reqID, err := r.PrepareWaitID(idType, id, info, options, opts...)
+	if err != nil {
+		return err
+	}
+	_, err = r.wait(reqID)
+	runtime.KeepAlive(info)
+	return err
+}
+
+// PrepareFutexWait is used to prepare a SQE that waits on a futex while its
+// value is val.
+func (r *Ring) PrepareFutexWait(
+	addr *uint32,
+	val uint64,
+	mask uint64,
+	flags uint32,
+	opts ...OpOption,
+) (uint64, error) {
+	sqe, ready, err := r.extEntry(FutexWait)
+	if err != nil {
+		return 0, err
+	}
+
+	r.pin(sqe.UserData, addr)
+	sqe.Fd = int32(flags)
+	sqe.Addr = (uint64)(uintptr(unsafe.Pointer(addr)))
+	sqe.Offset = val
+	setAddr3(sqe, mask)
+
+	r.applyOpOptions(sqe, opts)
+	ready()
+	return sqe.UserData, nil
+}
+
+// FutexWait is used to wait on a futex while its value is val.
+func (r *Ring) FutexWait(addr *uint32, val uint64, mask uint64, flags uint32, opts ...OpOption) error {
+	id, err := r.PrepareFutexWait(addr, val, mask, flags, opts...)
+	if err != nil {
+		return err
+	}
+	_, err = r.wait(id)
+	return err
+}
+
+// PrepareFutexWake is used to prepare a SQE that wakes up to n waiters of a
+// futex.
+func (r *Ring) PrepareFutexWake(
+	addr *uint32,
+	n uint64,
+	mask uint64,
+	flags uint32,
+	opts ...OpOption,
+) (uint64, error) {
+	sqe, ready, err := r.extEntry(FutexWake)
+	if err != nil {
+		return 0, err
+	}
+
+	r.pin(sqe.UserData, addr)
+	sqe.Fd = int32(flags)
+	sqe.Addr = (uint64)(uintptr(unsafe.Pointer(addr)))
+	sqe.Offset = n
+	setAddr3(sqe, mask)
+
+	r.applyOpOptions(sqe, opts)
+	ready()
+	return sqe.UserData, nil
+}
+
+// FutexWake is used to wake up to n waiters of a futex, it returns the number
+// of waiters that were woken.
+func (r *Ring) FutexWake(addr *uint32, n uint64, mask uint64, flags uint32, opts ...OpOption) (int, error) {
+	id, err := r.PrepareFutexWake(addr, n, mask, flags, opts...)
+	if err != nil {
+		return 0, err
+	}
+	res, err := r.wait(id)
+	return int(res), err
+}
+
+// PrepareFixedFdInstall is used to prepare a SQE that installs a registered
+// file into the process file table.
+func (r *Ring) PrepareFixedFdInstall(index int, flags int, opts ...OpOption) (uint64, error) {
+	sqe, ready, err := r.extEntry(FixedFdInstall)
+	if err != nil {
+		return 0, err
+	}
+
+	sqe.Fd = int32(index)
+	sqe.Flags = SqeFixedFile
+	sqe.UFlags = int32(flags)
+
+	r.applyOpOptions(sqe, opts)
+	ready()
+	return sqe.UserData, nil
+}
+
+// FixedFdInstall is used to install the registered file at the index into
+// the process file table, it returns the new file descriptor.
+func (r *Ring) FixedFdInstall(index int, flags int, opts ...OpOption) (int, error) {
+	id, err := r.PrepareFixedFdInstall(index, flags, opts...)
+	if err != nil {
+		return -1, err
+	}
+	res, err := r.wait(id)
+	if err != nil {
+		return -1, err
+	}
+	return int(res), nil
+}
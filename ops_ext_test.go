@@ -0,0 +1,284 @@
+// +build linux
+
+package iouring
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func requireOp(t *testing.T, r *Ring, op Opcode) {
+	if !r.Supported(op) {
+		t.Skipf("opcode %d not supported", op)
+	}
+}
+
+func TestRingFileOps(t *testing.T) {
+	r, err := New(2048, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	requireOp(t, r, LinkAt)
+
+	dir, err := ioutil.TempDir("", "ops")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	sub := filepath.Join(dir, "sub")
+	require.NoError(t, r.MkdirAt(unix.AT_FDCWD, sub, 0755))
+	fi, err := os.Stat(sub)
+	require.NoError(t, err)
+	require.True(t, fi.IsDir())
+	require.Equal(t, syscall.EEXIST, r.MkdirAt(unix.AT_FDCWD, sub, 0755))
+
+	path := filepath.Join(sub, "file")
+	require.NoError(t, ioutil.WriteFile(path, []byte("test"), 0644))
+	renamed := filepath.Join(sub, "renamed")
+	require.NoError(t, r.RenameAt(unix.AT_FDCWD, path, unix.AT_FDCWD, renamed, 0))
+	_, err = os.Stat(path)
+	require.True(t, os.IsNotExist(err))
+
+	link := filepath.Join(sub, "link")
+	require.NoError(t, r.LinkAt(unix.AT_FDCWD, renamed, unix.AT_FDCWD, link, 0))
+	b, err := ioutil.ReadFile(link)
+	require.NoError(t, err)
+	require.Equal(t, "test", string(b))
+
+	symlink := filepath.Join(sub, "symlink")
+	require.NoError(t, r.SymlinkAt(renamed, unix.AT_FDCWD, symlink))
+	target, err := os.Readlink(symlink)
+	require.NoError(t, err)
+	require.Equal(t, renamed, target)
+
+	for _, p := range []string{renamed, link, symlink} {
+		require.NoError(t, r.UnlinkAt(unix.AT_FDCWD, p, 0))
+	}
+	require.NoError(t, r.UnlinkAt(unix.AT_FDCWD, sub, unix.AT_REMOVEDIR))
+	_, err = os.Stat(sub)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestRingXattr(t *testing.T) {
+	r, err := New(2048, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	requireOp(t, r, GetXattr)
+
+	f, err := ioutil.TempFile("", "xattr")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	err = r.FSetXattr(int(f.Fd()), "user.test", []byte("value"), 0)
+	if err == syscall.EOPNOTSUPP {
+		t.Skip("user xattrs not supported")
+	}
+	require.NoError(t, err)
+	require.NoError(t, r.SetXattr(f.Name(), "user.other", []byte("other"), 0))
+
+	b := make([]byte, 64)
+	n, err := r.FGetXattr(int(f.Fd()), "user.other", b)
+	require.NoError(t, err)
+	require.Equal(t, "other", string(b[:n]))
+	n, err = r.GetXattr(f.Name(), "user.test", b)
+	require.NoError(t, err)
+	require.Equal(t, "value", string(b[:n]))
+
+	_, err = r.GetXattr(f.Name(), "user.missing", b)
+	require.Equal(t, syscall.ENODATA, err)
+}
+
+func TestRingTee(t *testing.T) {
+	r, err := New(2048, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	requireOp(t, r, Tee)
+
+	var in, out [2]int
+	require.NoError(t, unix.Pipe(in[:]))
+	require.NoError(t, unix.Pipe(out[:]))
+	defer func() {
+		for _, fd := range append(in[:], out[:]...) {
+			unix.Close(fd)
+		}
+	}()
+
+	_, err = unix.Write(in[1], []byte("test"))
+	require.NoError(t, err)
+	n, err := r.Tee(in[0], out[1], 4, 0)
+	require.NoError(t, err)
+	require.Equal(t, int64(4), n)
+
+	// The data is duplicated, not consumed.
+	for _, fd := range []int{in[0], out[0]} {
+		b := make([]byte, 4)
+		_, err = unix.Read(fd, b)
+		require.NoError(t, err)
+		require.Equal(t, "test", string(b))
+	}
+}
+
+func TestRingSocketShutdown(t *testing.T) {
+	r, err := New(2048, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	requireOp(t, r, Socket)
+
+	fd, err := r.Socket(unix.AF_INET, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+	require.NoError(t, err)
+	defer unix.Close(fd)
+	typ, err := unix.GetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_TYPE)
+	require.NoError(t, err)
+	require.Equal(t, unix.SOCK_STREAM, typ)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	port := l.Addr().(*net.TCPAddr).Port
+	require.NoError(t, unix.Connect(fd, &unix.SockaddrInet4{
+		Port: port,
+		Addr: [4]byte{127, 0, 0, 1},
+	}))
+	c, err := l.Accept()
+	require.NoError(t, err)
+	defer c.Close()
+
+	require.NoError(t, r.Shutdown(fd, unix.SHUT_WR))
+	c.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := c.Read(make([]byte, 1))
+	require.Equal(t, 0, n)
+	require.Error(t, err)
+}
+
+func TestRingSendZC(t *testing.T) {
+	r, err := New(2048, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	requireOp(t, r, SendZC)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+	require.NoError(t, err)
+	defer unix.Close(fd)
+	require.NoError(t, unix.Connect(fd, &unix.SockaddrInet4{
+		Port: l.Addr().(*net.TCPAddr).Port,
+		Addr: [4]byte{127, 0, 0, 1},
+	}))
+	c, err := l.Accept()
+	require.NoError(t, err)
+	defer c.Close()
+
+	n, err := r.SendZCWait(fd, []byte("test"), 0)
+	require.NoError(t, err)
+	require.Equal(t, 4, n)
+
+	b := make([]byte, 4)
+	c.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = io.ReadFull(c, b)
+	require.NoError(t, err)
+	require.Equal(t, "test", string(b))
+}
+
+func TestRingMsgRing(t *testing.T) {
+	r, err := New(2048, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	requireOp(t, r, MsgRing)
+
+	target, err := New(2048, nil)
+	require.NoError(t, err)
+	require.NotNil(t, target)
+
+	c := make(chan CompletionEntry, 1)
+	id := target.ID()
+	target.streamTo(id, c)
+	require.NoError(t, r.MsgRing(target.Fd(), 42, id, 0))
+
+	select {
+	case cqe := <-c:
+		require.Equal(t, id, cqe.UserData)
+		require.Equal(t, int32(42), cqe.Res)
+	case <-time.After(time.Second):
+		t.Fatal("message not received")
+	}
+}
+
+func TestRingWaitID(t *testing.T) {
+	r, err := New(2048, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	requireOp(t, r, WaitID)
+
+	cmd := exec.Command("/bin/sh", "-c", "exit 3")
+	require.NoError(t, cmd.Start())
+
+	var info WaitIDInfo
+	require.NoError(t, r.WaitID(PPid, cmd.Process.Pid, &info, unix.WEXITED))
+	require.Equal(t, int32(cmd.Process.Pid), info.Pid)
+	require.Equal(t, int32(unix.SIGCHLD), info.Signo)
+	require.Equal(t, int32(3), info.Status)
+}
+
+func TestRingFutex(t *testing.T) {
+	r, err := New(2048, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	requireOp(t, r, FutexWake)
+
+	var futex uint32
+	flags := uint32(Futex2SizeU32 | Futex2Private)
+
+	// The value doesn't match so the wait returns immediately.
+	require.Equal(t, syscall.EAGAIN, r.FutexWait(&futex, 1, FutexBitsetMatchAny, flags))
+
+	done := make(chan error, 1)
+	go func() {
+		done <- r.FutexWait(&futex, 0, FutexBitsetMatchAny, flags)
+	}()
+	for {
+		n, err := r.FutexWake(&futex, 1, FutexBitsetMatchAny, flags)
+		require.NoError(t, err)
+		if n == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	atomic.StoreUint32(&futex, 1)
+	require.NoError(t, <-done)
+}
+
+func TestRingFixedFdInstall(t *testing.T) {
+	r, err := New(2048, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	requireOp(t, r, FixedFdInstall)
+
+	var p [2]int
+	require.NoError(t, unix.Pipe(p[:]))
+	defer unix.Close(p[0])
+	defer unix.Close(p[1])
+	require.NoError(t, RegisterFiles(r.Fd(), []int{p[1]}))
+
+	fd, err := r.FixedFdInstall(0, 0)
+	require.NoError(t, err)
+	defer unix.Close(fd)
+	require.NotEqual(t, p[1], fd)
+	_, err = unix.Write(fd, []byte("test"))
+	require.NoError(t, err)
+	b := make([]byte, 4)
+	_, err = unix.Read(p[0], b)
+	require.NoError(t, err)
+	require.Equal(t, "test", string(b))
+}
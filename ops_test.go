@@ -11,6 +11,7 @@ import (
 	"net"
 	"os"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"testing"
 	"time"
@@ -94,6 +95,25 @@ func TestFadvise(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestMadvise(t *testing.T) {
+	r, err := New(2048, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+
+	b := pageAligned(4 * os.Getpagesize())
+	require.NoError(t, r.Madvise(b, unix.MADV_WILLNEED))
+
+	for i := range b {
+		b[i] = 1
+	}
+	require.NoError(t, r.Madvise(b, unix.MADV_DONTNEED))
+	// Anonymous memory is zero filled after it is dropped.
+	require.Equal(t, make([]byte, len(b)), b)
+
+	err = r.Madvise(b[1:], unix.MADV_DONTNEED)
+	require.Equal(t, syscall.EINVAL, err)
+}
+
 func TestFallocate(t *testing.T) {
 	r, err := New(2048, nil)
 	require.NoError(t, err)
@@ -254,6 +274,30 @@ func TestPollAdd(t *testing.T) {
 	wg.Wait()
 }
 
+func TestOpenAt(t *testing.T) {
+	r, err := New(2048, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+
+	f, err := ioutil.TempFile("", "openat")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.Write([]byte("test"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	fd, err := r.OpenAt(unix.AT_FDCWD, f.Name(), unix.O_RDONLY, 0)
+	require.NoError(t, err)
+	defer unix.Close(fd)
+	b := make([]byte, 4)
+	_, err = unix.Read(fd, b)
+	require.NoError(t, err)
+	require.Equal(t, "test", string(b))
+
+	_, err = r.OpenAt(unix.AT_FDCWD, f.Name()+".missing", unix.O_RDONLY, 0)
+	require.Equal(t, syscall.ENOENT, err)
+}
+
 func TestPrepareReadv(t *testing.T) {
 	r, err := New(2048, nil)
 	require.NoError(t, err)
@@ -379,6 +423,18 @@ func TestRingStatx(t *testing.T) {
 	err = unix.Statx(int(d.Fd()), path, 0, unix.STATX_ALL, &x2)
 	require.NoError(t, err)
 	require.Equal(t, x1, x2)
+	require.Zero(t, atomic.LoadInt32(&r.npins))
+
+	// The path is unpinned when the completion isn't reaped by Run.
+	id, err := r.PrepareStatx(int(d.Fd()), path, 0, unix.STATX_ALL, &x1)
+	require.NoError(t, err)
+	_, err = r.Enter(1, 1, EnterGetEvents, nil)
+	require.NoError(t, err)
+	_, _, err = r.getCqe(id)
+	require.NoError(t, err)
+	require.Zero(t, atomic.LoadInt32(&r.npins))
+	_, ok := r.pins.Load(id)
+	require.False(t, ok)
 }
 
 func TestSend(t *testing.T) {
@@ -0,0 +1,79 @@
+// +build linux
+
+package iouring
+
+import (
+	"encoding/binary"
+	"syscall"
+)
+
+// Personality is the id of credentials that are registered with a ring,
+// requests that use a personality run with its credentials.
+type Personality uint16
+
+// RegisterPersonality is used to register the credentials of the calling
+// thread with a ring.
+func RegisterPersonality(ringFd int) (Personality, error) {
+	id, _, errno := syscall.Syscall6(
+		RegisterSyscall,
+		uintptr(ringFd),
+		uintptr(RegRegisterPersonality),
+		uintptr(0),
+		uintptr(0),
+		uintptr(0),
+		uintptr(0),
+	)
+	if errno != 0 {
+		return 0, errno
+	}
+	return Personality(id), nil
+}
+
+// UnregisterPersonality is used to unregister credentials from a ring.
+func UnregisterPersonality(ringFd int, p Personality) error {
+	_, _, errno := syscall.Syscall6(
+		RegisterSyscall,
+		uintptr(ringFd),
+		uintptr(RegUnregisterPersonality),
+		uintptr(0),
+		uintptr(p),
+		uintptr(0),
+		uintptr(0),
+	)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// RegisterPersonality is used to register the credentials of the calling
+// thread, use runtime.LockOSThread when the thread's credentials differ from
+// the process. Rings with a locked worker register the credentials of the
+// worker thread.
+func (r *Ring) RegisterPersonality() (Personality, error) {
+	var p Personality
+	err := r.issue(func() error {
+		var err error
+		p, err = RegisterPersonality(r.fd)
+		return err
+	})
+	return p, err
+}
+
+// UnregisterPersonality is used to unregister a personality.
+func (r *Ring) UnregisterPersonality(p Personality) error {
+	return r.issue(func() error { return UnregisterPersonality(r.fd, p) })
+}
+
+// WithPersonality is used to run a request with the credentials of a
+// registered personality.
+func WithPersonality(p Personality) OpOption {
+	return func(o *OpOptions) {
+		o.Personality = p
+	}
+}
+
+// setPersonality is used to set the personality of a SubmitEntry.
+func setPersonality(sqe *SubmitEntry, p Personality) {
+	binary.LittleEndian.PutUint16(sqe.Anon0[2:4], uint16(p))
+}
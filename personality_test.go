@@ -0,0 +1,72 @@
+// +build linux
+
+package iouring
+
+import (
+	"io/ioutil"
+	"os"
+	"runtime"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestRingPersonality(t *testing.T) {
+	r, err := New(2048, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+
+	p, err := r.RegisterPersonality()
+	require.NoError(t, err)
+	require.NotZero(t, p)
+	require.NoError(t, r.Nop(WithPersonality(p)))
+
+	require.NoError(t, r.UnregisterPersonality(p))
+	require.Equal(t, syscall.EINVAL, r.Nop(WithPersonality(p)))
+	require.Equal(t, syscall.EINVAL, r.UnregisterPersonality(p))
+}
+
+func TestRingPersonalityCredentials(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("changing credentials requires root")
+	}
+	r, err := New(2048, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+
+	f, err := ioutil.TempFile("", "personality")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	require.NoError(t, f.Chmod(0600))
+	require.NoError(t, f.Close())
+
+	// Register the credentials of an unprivileged user from a thread
+	// that is discarded afterwards, the process keeps its credentials.
+	type result struct {
+		p   Personality
+		err error
+	}
+	c := make(chan result, 1)
+	go func() {
+		runtime.LockOSThread()
+		_, _, errno := syscall.RawSyscall(unix.SYS_SETRESUID, 65534, 65534, 0)
+		if errno != 0 {
+			c <- result{err: errno}
+			return
+		}
+		p, err := r.RegisterPersonality()
+		c <- result{p: p, err: err}
+	}()
+	res := <-c
+	require.NoError(t, res.err)
+	defer r.UnregisterPersonality(res.p)
+
+	_, err = r.OpenAt(unix.AT_FDCWD, f.Name(), unix.O_RDONLY, 0, WithPersonality(res.p))
+	require.Equal(t, syscall.EACCES, err)
+
+	fd, err := r.OpenAt(unix.AT_FDCWD, f.Name(), unix.O_RDONLY, 0)
+	require.NoError(t, err)
+	unix.Close(fd)
+}
@@ -0,0 +1,257 @@
+// +build linux
+
+package iouring
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"syscall"
+)
+
+// PollHandler is called by a Poller with the events that are ready for a file
+// descriptor.
+type PollHandler func(fd int, events int)
+
+// pollEntry is a file descriptor registered with a Poller.
+type pollEntry struct {
+	fd      int
+	events  int
+	handler PollHandler
+	// id is the user data of the armed poll.
+	id uint64
+}
+
+// Poller is a readiness reactor similar to epoll that is built on one-shot
+// polls. Polls are re-armed after the handler returns, so events are level
+// triggered.
+type Poller struct {
+	r *Ring
+	// completions is the stream of the armed polls, it is drained by pump
+	// so the ring never blocks on a handler.
+	completions chan CompletionEntry
+	// streams is the number of armed polls that haven't completed.
+	streams int64
+	// events are the completions queued for Run by pump.
+	events chan CompletionEntry
+	done   chan struct{}
+	once   sync.Once
+
+	mu    sync.Mutex
+	fds   map[int]*pollEntry
+	armed map[uint64]*pollEntry
+}
+
+// NewPoller returns a Poller that uses the ring. The Run method must be
+// called for handlers to be called.
+func (r *Ring) NewPoller() *Poller {
+	p := &Poller{
+		r:           r,
+		completions: make(chan CompletionEntry, r.cq.Len()),
+		events:      make(chan CompletionEntry),
+		done:        make(chan struct{}),
+		fds:         map[int]*pollEntry{},
+		armed:       map[uint64]*pollEntry{},
+	}
+	go p.pump()
+	return p
+}
+
+// pump is used to queue the completions of the polls until Run dispatches
+// them, handlers arm polls so the ring must not block delivering to Run.
+// After Close the completions are dropped until all armed polls completed.
+func (p *Poller) pump() {
+	var queue []CompletionEntry
+	for {
+		var (
+			events chan CompletionEntry
+			next   CompletionEntry
+		)
+		if len(queue) > 0 {
+			events = p.events
+			next = queue[0]
+		}
+		select {
+		case cqe := <-p.completions:
+			atomic.AddInt64(&p.streams, -1)
+			queue = append(queue, cqe)
+		case events <- next:
+			queue = queue[1:]
+		case <-p.done:
+			for atomic.LoadInt64(&p.streams) > 0 {
+				<-p.completions
+				atomic.AddInt64(&p.streams, -1)
+			}
+			return
+		}
+	}
+}
+
+// arm is used to add a poll for the entry, the lock must not be held as
+// delivering the completions of the ring may wait on a handler. The poll is
+// removed if the entry was removed or modified while it was armed.
+func (p *Poller) arm(e *pollEntry) error {
+	id, err := p.r.PreparePollAdd(e.fd, e.events)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	current := p.fds[e.fd] == e
+	if current {
+		e.id = id
+		p.armed[id] = e
+	}
+	p.mu.Unlock()
+	atomic.AddInt64(&p.streams, 1)
+	p.r.streamTo(id, p.completions)
+	if !current {
+		return p.disarm(id)
+	}
+	return nil
+}
+
+// forget is used to remove an entry that failed to arm.
+func (p *Poller) forget(e *pollEntry) {
+	p.mu.Lock()
+	if p.fds[e.fd] == e {
+		delete(p.fds, e.fd)
+	}
+	p.mu.Unlock()
+}
+
+// disarm is used to remove an armed poll, it is fine if the poll has already
+// completed.
+func (p *Poller) disarm(id uint64) error {
+	err := p.r.PollRemove(id)
+	if err == syscall.ENOENT || err == syscall.EALREADY {
+		return nil
+	}
+	return err
+}
+
+// Add is used to call the handler when any of the events (POLLIN, POLLOUT,
+// etc) are ready for the file descriptor.
+func (p *Poller) Add(fd int, events int, handler PollHandler) error {
+	p.mu.Lock()
+	if _, ok := p.fds[fd]; ok {
+		p.mu.Unlock()
+		return fmt.Errorf("fd %d already added", fd)
+	}
+	e := &pollEntry{fd: fd, events: events, handler: handler}
+	p.fds[fd] = e
+	p.mu.Unlock()
+	if err := p.arm(e); err != nil {
+		p.forget(e)
+		return err
+	}
+	return nil
+}
+
+// Modify is used to change the events for a file descriptor.
+func (p *Poller) Modify(fd int, events int) error {
+	p.mu.Lock()
+	old, ok := p.fds[fd]
+	if !ok {
+		p.mu.Unlock()
+		return fmt.Errorf("fd %d not added", fd)
+	}
+	e := &pollEntry{fd: fd, events: events, handler: old.handler}
+	delete(p.armed, old.id)
+	p.fds[fd] = e
+	p.mu.Unlock()
+	if err := p.arm(e); err != nil {
+		p.forget(e)
+		p.disarm(old.id)
+		return err
+	}
+	return p.disarm(old.id)
+}
+
+// Remove is used to stop polling a file descriptor.
+func (p *Poller) Remove(fd int) error {
+	p.mu.Lock()
+	e, ok := p.fds[fd]
+	if !ok {
+		p.mu.Unlock()
+		return fmt.Errorf("fd %d not added", fd)
+	}
+	delete(p.fds, fd)
+	delete(p.armed, e.id)
+	p.mu.Unlock()
+	return p.disarm(e.id)
+}
+
+// Run is used to dispatch events to handlers until the context is done or the
+// Poller is closed. Handlers are called from the calling goroutine.
+func (p *Poller) Run(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-p.done:
+			return nil
+		case cqe := <-p.events:
+			if err := p.dispatch(cqe); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// dispatch is used to call the handler for a completed poll and re-arm it.
+func (p *Poller) dispatch(cqe CompletionEntry) error {
+	p.mu.Lock()
+	e, ok := p.armed[cqe.UserData]
+	if !ok {
+		// The fd was removed or modified.
+		p.mu.Unlock()
+		return nil
+	}
+	delete(p.armed, cqe.UserData)
+	events := int(cqe.Res)
+	if cqe.Res < 0 {
+		// The poll failed, similar to epoll report it as an error
+		// and stop polling the fd.
+		delete(p.fds, e.fd)
+		events = POLLERR
+		if syscall.Errno(-cqe.Res) == syscall.EBADF {
+			events = POLLNVAL
+		}
+	}
+	p.mu.Unlock()
+
+	e.handler(e.fd, events)
+
+	p.mu.Lock()
+	current := p.fds[e.fd] == e
+	p.mu.Unlock()
+	if !current {
+		// The handler removed or modified the fd.
+		return nil
+	}
+	return p.arm(e)
+}
+
+// Close is used to remove all polls and stop the Run method.
+func (p *Poller) Close() error {
+	p.once.Do(func() {
+		close(p.done)
+	})
+	p.mu.Lock()
+	ids := make([]uint64, 0, len(p.armed))
+	for id := range p.armed {
+		ids = append(ids, id)
+	}
+	p.fds = map[int]*pollEntry{}
+	p.armed = map[uint64]*pollEntry{}
+	p.mu.Unlock()
+
+	var err error
+	for _, id := range ids {
+		if rErr := p.disarm(id); rErr != nil && err == nil {
+			err = rErr
+		}
+	}
+	return err
+}
@@ -0,0 +1,166 @@
+// +build linux
+
+package iouring
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestPollRemove(t *testing.T) {
+	r, err := New(2048, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+
+	var fds [2]int
+	require.NoError(t, syscall.Pipe(fds[:]))
+	defer syscall.Close(fds[0])
+	defer syscall.Close(fds[1])
+
+	id, err := r.PreparePollAdd(fds[0], POLLIN)
+	require.NoError(t, err)
+	require.NoError(t, r.PollRemove(id))
+	res, _ := r.complete(id)
+	require.Equal(t, -int32(syscall.ECANCELED), res)
+
+	require.Equal(t, syscall.ENOENT, r.PollRemove(id))
+}
+
+func TestPoller(t *testing.T) {
+	r, err := New(2048, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+
+	p := r.NewPoller()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- p.Run(ctx)
+	}()
+
+	efd, err := unix.Eventfd(0, 0)
+	require.NoError(t, err)
+	defer syscall.Close(efd)
+
+	type event struct {
+		fd     int
+		events int
+	}
+	events := make(chan event, 16)
+	handler := func(fd int, ev int) {
+		events <- event{fd, ev}
+		if ev&POLLIN != 0 {
+			buf := make([]byte, 4096)
+			syscall.Read(fd, buf)
+		}
+	}
+	require.NoError(t, p.Add(efd, POLLIN, handler))
+	require.Error(t, p.Add(efd, POLLIN, handler))
+
+	// The poll is re-armed after each event.
+	for i := 0; i < 3; i++ {
+		_, err = syscall.Write(efd, []byte{1, 0, 0, 0, 0, 0, 0, 0})
+		require.NoError(t, err)
+		ev := <-events
+		require.Equal(t, efd, ev.fd)
+		require.True(t, ev.events&POLLIN != 0)
+	}
+
+	// An eventfd is always writable.
+	require.NoError(t, p.Modify(efd, POLLOUT))
+	ev := <-events
+	require.True(t, ev.events&POLLOUT != 0)
+	require.NoError(t, p.Modify(efd, POLLIN))
+	for len(events) > 0 {
+		<-events
+	}
+
+	// inotify fds are pollable as well.
+	dir, err := ioutil.TempDir("", "poller")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	ifd, err := unix.InotifyInit1(unix.IN_NONBLOCK)
+	require.NoError(t, err)
+	defer syscall.Close(ifd)
+	_, err = unix.InotifyAddWatch(ifd, dir, unix.IN_CREATE)
+	require.NoError(t, err)
+	require.NoError(t, p.Add(ifd, POLLIN, handler))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "f"), nil, 0644))
+	ev = <-events
+	require.Equal(t, ifd, ev.fd)
+
+	require.NoError(t, p.Remove(efd))
+	require.Error(t, p.Remove(efd))
+	_, err = syscall.Write(efd, []byte{1, 0, 0, 0, 0, 0, 0, 0})
+	require.NoError(t, err)
+	select {
+	case ev := <-events:
+		t.Fatalf("unexpected event after remove: %+v", ev)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	require.NoError(t, p.Close())
+	require.NoError(t, <-runErr)
+}
+
+func TestPollerHandlerAdd(t *testing.T) {
+	// A small ring so the completions of the polls fill the queue while
+	// handlers and other goroutines add polls.
+	r, err := New(4, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+
+	p := r.NewPoller()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- p.Run(ctx)
+	}()
+
+	// eventfds are always writable so every poll completes at once.
+	fds := make([]int, 32)
+	for i := range fds {
+		fds[i], err = unix.Eventfd(0, 0)
+		require.NoError(t, err)
+		defer syscall.Close(fds[i])
+	}
+	var handler PollHandler
+	handled := make(chan struct{}, 1)
+	handler = func(fd int, ev int) {
+		// Removing and adding from the handler must not wait on the ring.
+		p.Remove(fd)
+		p.Add(fd, POLLOUT, handler)
+		select {
+		case handled <- struct{}{}:
+		default:
+		}
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 256; i++ {
+			fd := fds[i%len(fds)]
+			p.Remove(fd)
+			p.Add(fd, POLLOUT, handler)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("adding polls while handling events deadlocked")
+	}
+	<-handled
+
+	require.NoError(t, p.Close())
+	require.NoError(t, <-runErr)
+}
@@ -0,0 +1,145 @@
+// +build linux
+
+package iouring
+
+import (
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// probeOps is the number of ops in a Probe.
+	probeOps = 256
+)
+
+// ProbeOp is the result of probing an opcode.
+type ProbeOp struct {
+	Op    uint8
+	Resv  uint8
+	Flags uint16
+	Resv2 uint32
+}
+
+// Probe is used to determine what opcodes are supported by the kernel.
+type Probe struct {
+	LastOp uint8
+	OpsLen uint8
+	Resv   uint16
+	Resv2  [3]uint32
+	Ops    [probeOps]ProbeOp
+}
+
+// Supported returns if the opcode is supported.
+func (p *Probe) Supported(op Opcode) bool {
+	if op > Opcode(p.LastOp) {
+		return false
+	}
+	return p.Ops[op].Flags&OpSupported != 0
+}
+
+// RegisterProbe is used to probe the opcodes supported by a ring.
+func RegisterProbe(ringFd int) (*Probe, error) {
+	p := &Probe{}
+	_, _, errno := syscall.Syscall6(
+		RegisterSyscall,
+		uintptr(ringFd),
+		uintptr(RegRegisterProbe),
+		uintptr(unsafe.Pointer(p)),
+		uintptr(probeOps),
+		uintptr(0),
+		uintptr(0),
+	)
+	if errno != 0 {
+		var err error
+		err = errno
+		return nil, err
+	}
+	return p, nil
+}
+
+// Probe returns the opcodes supported by the ring, the result is cached after
+// the first call.
+func (r *Ring) Probe() (*Probe, error) {
+	r.probeOnce.Do(func() {
+		r.probeErr = r.issue(func() error {
+			var err error
+			r.probe, err = RegisterProbe(r.fd)
+			return err
+		})
+	})
+	return r.probe, r.probeErr
+}
+
+// Supported returns if an opcode is supported by the ring.
+func (r *Ring) Supported(op Opcode) bool {
+	p, err := r.Probe()
+	if err != nil {
+		return false
+	}
+	return p.Supported(op)
+}
+
+// MultishotSupported returns if the multishot variant of an opcode is
+// supported. Multishot support isn't reported by the probe, so the first call
+// for an opcode submits a multishot request, the result is cached.
+func (r *Ring) MultishotSupported(op Opcode) bool {
+	switch op {
+	case PollAdd, Accept, Recv:
+	default:
+		return false
+	}
+	r.multishotMu.Lock()
+	defer r.multishotMu.Unlock()
+	supported, ok := r.multishotOps[op]
+	if !ok {
+		supported = r.probeMultishot(op)
+		if r.multishotOps == nil {
+			r.multishotOps = map[Opcode]bool{}
+		}
+		r.multishotOps[op] = supported
+	}
+	return supported
+}
+
+// probeMultishot is used to submit a multishot request on an eventfd, kernels
+// without multishot support for the opcode reject the request with EINVAL.
+// Accept and Recv fail as an eventfd isn't a socket and the poll is canceled.
+func (r *Ring) probeMultishot(op Opcode) bool {
+	if !r.Supported(op) {
+		return false
+	}
+	fd, err := unix.Eventfd(0, unix.EFD_NONBLOCK|unix.EFD_CLOEXEC)
+	if err != nil {
+		return false
+	}
+	defer unix.Close(fd)
+	sqe, ready := r.SubmitEntry()
+	if sqe == nil {
+		return false
+	}
+
+	sqe.Opcode = op
+	sqe.UserData = r.ID()
+	sqe.Fd = int32(fd)
+	switch op {
+	case PollAdd:
+		// An eventfd is always writable.
+		sqe.UFlags = int32(POLLOUT)
+		sqe.Len = PollAddMulti
+	case Accept:
+		sqe.Ioprio = AcceptMultishot
+	case Recv:
+		sqe.Flags = SqeBufferSelect
+		sqe.Ioprio = RecvMultishot
+	}
+	ms := r.multishot(sqe, ready, nil)
+	cqe := <-ms.C
+	if cqe.Flags&CqeFMore != 0 {
+		ms.Cancel()
+	}
+	for range ms.C {
+	}
+	return cqe.Res != -int32(syscall.EINVAL)
+}
@@ -0,0 +1,52 @@
+// +build linux
+
+package iouring
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestRingProbe(t *testing.T) {
+	r, err := New(2048, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+
+	p, err := r.Probe()
+	require.NoError(t, err)
+	require.True(t, p.Supported(Nop))
+	require.True(t, r.Supported(Read))
+	require.False(t, p.Supported(Opcode(255)))
+
+	p2, err := r.Probe()
+	require.NoError(t, err)
+	require.True(t, p == p2)
+}
+
+func TestMultishotSupported(t *testing.T) {
+	r, err := New(2048, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+
+	var uts unix.Utsname
+	require.NoError(t, unix.Uname(&uts))
+	var major, minor int
+	_, err = fmt.Sscanf(string(uts.Release[:]), "%d.%d", &major, &minor)
+	require.NoError(t, err)
+	since := func(maj, min int) bool {
+		return major > maj || major == maj && minor >= min
+	}
+
+	require.Equal(t, since(5, 13), r.MultishotSupported(PollAdd))
+	require.Equal(t, since(5, 19), r.MultishotSupported(Accept))
+	require.Equal(t, since(6, 0), r.MultishotSupported(Recv))
+	require.False(t, r.MultishotSupported(Read))
+
+	// The result is cached and the probes don't leave requests behind.
+	require.Equal(t, since(5, 13), r.MultishotSupported(PollAdd))
+	require.NoError(t, r.Nop())
+	require.NoError(t, r.Stop())
+}
@@ -0,0 +1,139 @@
+// +build linux
+
+package iouring
+
+import (
+	"sync"
+	"time"
+)
+
+// ioClass is used to group opcodes for rate limiting.
+type ioClass int
+
+const (
+	ioClassRead ioClass = iota
+	ioClassWrite
+	ioClassOther
+	numIOClasses
+)
+
+// opClass returns the ioClass of an opcode.
+func opClass(op Opcode) ioClass {
+	switch op {
+	case Read, ReadFixed, Readv, Recv, RecvMsg:
+		return ioClassRead
+	case Write, WriteFixed, Writev, Send, SendMsg:
+		return ioClassWrite
+	default:
+		return ioClassOther
+	}
+}
+
+// tokenBucket is a token bucket that allows going into debt, so that a
+// request larger than the bucket size is delayed rather than rejected.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket returns a tokenBucket that refills at rate tokens per second
+// and holds at most one second worth of tokens.
+func newTokenBucket(rate float64) *tokenBucket {
+	return &tokenBucket{
+		rate:   rate,
+		burst:  rate,
+		tokens: rate,
+		last:   time.Now(),
+	}
+}
+
+// take removes n tokens from the bucket and returns how long the caller must
+// wait for the tokens to be available.
+func (b *tokenBucket) take(n float64) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// rateLimiter limits the rate of SQEs committed to a ring, each ioClass has
+// its own set of buckets and deadline. The opcode and length of a SQE are only
+// known once it is written, so committing a SQE charges the buckets of its
+// class and the committer waits out the deadline of the class. A SQE is never
+// held while waiting, which would stall entering the ring, and a class over
+// its limit doesn't delay the other classes.
+type rateLimiter struct {
+	iops  [numIOClasses]*tokenBucket
+	bytes [numIOClasses]*tokenBucket
+
+	mu    sync.Mutex
+	until [numIOClasses]time.Time
+}
+
+func newRateLimiter(iops int, bytesPerSec int64) *rateLimiter {
+	l := &rateLimiter{}
+	for c := ioClass(0); c < numIOClasses; c++ {
+		if iops > 0 {
+			l.iops[c] = newTokenBucket(float64(iops))
+		}
+		if bytesPerSec > 0 {
+			l.bytes[c] = newTokenBucket(float64(bytesPerSec))
+		}
+	}
+	return l
+}
+
+// delay returns how long until the class is within its limits.
+func (l *rateLimiter) delay(c ioClass) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return time.Until(l.until[c])
+}
+
+// wait blocks until the class is within its limits.
+func (l *rateLimiter) wait(c ioClass) {
+	if d := l.delay(c); d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// charge takes the tokens for a committed SubmitEntry from the buckets of its
+// class and returns the class.
+func (l *rateLimiter) charge(sqe *SubmitEntry) ioClass {
+	c := opClass(sqe.Opcode)
+	var d time.Duration
+	if b := l.iops[c]; b != nil {
+		d = b.take(1)
+	}
+	// Only non vectored read and writes use the length as the number of
+	// bytes.
+	if b := l.bytes[c]; b != nil && c != ioClassOther &&
+		sqe.Opcode != Readv && sqe.Opcode != Writev && sqe.Opcode != RecvMsg && sqe.Opcode != SendMsg {
+		if bd := b.take(float64(sqe.Len)); bd > d {
+			d = bd
+		}
+	}
+	if d <= 0 {
+		return c
+	}
+	until := time.Now().Add(d)
+	l.mu.Lock()
+	if until.After(l.until[c]) {
+		l.until[c] = until
+	}
+	l.mu.Unlock()
+	return c
+}
@@ -0,0 +1,102 @@
+// +build linux
+
+package iouring
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenBucket(t *testing.T) {
+	b := newTokenBucket(100)
+	require.Zero(t, b.take(100))
+	d := b.take(50)
+	require.True(t, d > 400*time.Millisecond && d <= 500*time.Millisecond, "wait %v", d)
+}
+
+func TestOpClass(t *testing.T) {
+	require.Equal(t, ioClassRead, opClass(Read))
+	require.Equal(t, ioClassRead, opClass(Recv))
+	require.Equal(t, ioClassWrite, opClass(WriteFixed))
+	require.Equal(t, ioClassOther, opClass(Nop))
+}
+
+func TestRateLimiterCharge(t *testing.T) {
+	l := newRateLimiter(10, 0)
+	sqe := &SubmitEntry{Opcode: Nop}
+	for i := 0; i < 10; i++ {
+		require.Equal(t, ioClassOther, l.charge(sqe))
+	}
+	require.True(t, l.until[ioClassOther].IsZero())
+	l.charge(sqe)
+	d := l.delay(ioClassOther)
+	require.True(t, d > 50*time.Millisecond && d <= 100*time.Millisecond, "wait %v", d)
+
+	// The other classes aren't delayed.
+	start := time.Now()
+	l.wait(ioClassRead)
+	require.True(t, time.Since(start) < 50*time.Millisecond)
+	l.wait(ioClassOther)
+	require.True(t, time.Since(start) >= 50*time.Millisecond)
+}
+
+func TestWithRateLimit(t *testing.T) {
+	r, err := New(1024, nil, WithRateLimit(100, 0))
+	require.NoError(t, err)
+	require.NotNil(t, r)
+
+	start := time.Now()
+	// The delay of a request is waited out once it is committed.
+	for i := 0; i < 111; i++ {
+		require.NoError(t, r.Nop())
+	}
+	require.True(t, time.Since(start) >= 90*time.Millisecond)
+}
+
+func TestWithRateLimitClasses(t *testing.T) {
+	r, err := New(1024, nil, WithRateLimit(0, 1<<20))
+	require.NoError(t, err)
+	defer r.Stop()
+
+	f, err := ioutil.TempFile("", "ratelimit")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+	rw, err := r.FileReadWriter(f)
+	require.NoError(t, err)
+
+	// The third write is over the limit and is delayed by half a second.
+	writes := make(chan time.Duration, 1)
+	go func() {
+		start := time.Now()
+		b := make([]byte, 1<<19)
+		for i := 0; i < 3; i++ {
+			_, err := rw.WriteAt(b, 0)
+			require.NoError(t, err)
+		}
+		writes <- time.Since(start)
+	}()
+	for {
+		r.limiter.mu.Lock()
+		throttled := time.Until(r.limiter.until[ioClassWrite]) > 0
+		r.limiter.mu.Unlock()
+		if throttled {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Reads keep their throughput while the writes are throttled.
+	start := time.Now()
+	b := make([]byte, 1)
+	for i := 0; i < 100; i++ {
+		_, err := rw.ReadAt(b, 0)
+		require.NoError(t, err)
+	}
+	require.True(t, time.Since(start) < 100*time.Millisecond, "reads took %v", time.Since(start))
+	require.True(t, <-writes >= 400*time.Millisecond)
+}
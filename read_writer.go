@@ -26,12 +26,22 @@ type ringFIO struct {
 	fd      int32
 	fOffset *int64
 	c       *completer
+	wb      *writeback
 }
 
 // getCqe is used for getting a CQE result and will retry up to one time.
 func (i *ringFIO) getCqe(reqID uint64, count, min int) (int, error) {
-	// TODO: consider adding the submitter interface here, or move out the
-	// submit function from this method all together.
+	// When the ring has a submitter it is responsible for entering the
+	// ring, waiting for completions here would block it from entering so
+	// wait for the completion to be delivered instead.
+	if i.r.submitter != nil {
+		res, _ := i.r.complete(reqID)
+		if res < 0 {
+			return 0, syscall.Errno(-res)
+		}
+		atomic.StoreInt64(i.fOffset, atomic.LoadInt64(i.fOffset)+int64(res))
+		return int(res), nil
+	}
 	if count > 0 || min > 0 {
 		_, err := i.r.Enter(uint(count), uint(min), EnterGetEvents, nil)
 		if err != nil {
@@ -40,51 +50,38 @@ func (i *ringFIO) getCqe(reqID uint64, count, min int) (int, error) {
 	}
 
 	cq := i.r.cq
-	foundIdx := 0
 findCqe:
+	// Only the entries between the head and the tail are posted, the
+	// kernel may still be writing the entries past the tail.
 	head := atomic.LoadUint32(cq.Head)
 	tail := atomic.LoadUint32(cq.Tail)
 	mask := atomic.LoadUint32(cq.Mask)
-	end := int(tail & mask)
-
-	for x := int(head & mask); x < len(cq.Entries); x++ {
-		cqe := cq.Entries[x]
+	for x := head; x != tail; x++ {
+		cqe := *cq.Entry(x & mask)
 		if cqe.UserData == reqID {
-			if cqe.Res < 0 {
-				return 0, syscall.Errno(-cqe.Res)
+			i.r.reaped(&cqe)
+			if i.r.rec != nil {
+				i.r.rec.complete(&cqe)
 			}
-			atomic.StoreInt64(i.fOffset, atomic.LoadInt64(i.fOffset)+int64(cqe.Res))
-			foundIdx = x
-			i.c.complete(foundIdx)
-			return int(cqe.Res), nil
-		}
-		if x == end {
-			goto findCqe
-		}
-	}
-	tail = atomic.LoadUint32(cq.Tail)
-	mask = atomic.LoadUint32(cq.Mask)
-	end = int(tail & mask)
-	for x := 0; x < end; x++ {
-		cqe := cq.Entries[x]
-		if cqe.UserData == reqID {
+			i.c.complete(int(x & mask))
 			if cqe.Res < 0 {
 				return 0, syscall.Errno(-cqe.Res)
 			}
 			atomic.StoreInt64(i.fOffset, atomic.LoadInt64(i.fOffset)+int64(cqe.Res))
-			foundIdx = x
-			i.c.complete(foundIdx)
 			return int(cqe.Res), nil
 		}
-		if x == end {
-			goto findCqe
-		}
+	}
+	// The completion may not be posted until the kernel runs the pending
+	// work of the request, which happens when getting events.
+	if _, err := i.r.Enter(0, 0, EnterGetEvents, nil); err != nil {
+		return 0, err
 	}
 	goto findCqe
 }
 
 // Write implements the io.Writer interface.
 func (i *ringFIO) Write(b []byte) (int, error) {
+	off := atomic.LoadInt64(i.fOffset)
 	id, ready, err := i.PrepareWrite(b, 0)
 	if err != nil {
 		return 0, err
@@ -92,7 +89,10 @@ func (i *ringFIO) Write(b []byte) (int, error) {
 	ready()
 	n, err := i.getCqe(id, 1, 1)
 	runtime.KeepAlive(b)
-	return n, err
+	if err != nil {
+		return n, err
+	}
+	return n, i.writeback(off, n)
 }
 
 // PrepareWrite is used to prepare a Write SQE. The ring is able to be entered
@@ -110,6 +110,7 @@ func (i *ringFIO) PrepareWrite(b []byte, flags uint8) (uint64, func(), error) {
 	sqe.Flags = flags
 	sqe.Offset = uint64(atomic.LoadInt64(i.fOffset))
 	sqe.Addr = (uint64)(uintptr(unsafe.Pointer(&b[0])))
+	i.r.applyOpOptions(sqe, nil)
 
 	return sqe.UserData, ready, nil
 }
@@ -129,6 +130,7 @@ func (i *ringFIO) PrepareRead(b []byte, flags uint8) (uint64, func(), error) {
 	sqe.Flags = flags
 	sqe.Offset = uint64(atomic.LoadInt64(i.fOffset))
 	sqe.Addr = (uint64)(uintptr(unsafe.Pointer(&b[0])))
+	i.r.applyOpOptions(sqe, nil)
 
 	return sqe.UserData, ready, nil
 }
@@ -165,12 +167,16 @@ func (i *ringFIO) WriteAt(b []byte, o int64) (int, error) {
 	sqe.Flags = 0
 	sqe.Offset = uint64(o)
 	sqe.Addr = (uint64)(uintptr(unsafe.Pointer(&b[0])))
+	i.r.applyOpOptions(sqe, nil)
 
 	ready()
 
 	n, err := i.getCqe(sqe.UserData, 1, 1)
 	runtime.KeepAlive(b)
-	return n, err
+	if err != nil {
+		return n, err
+	}
+	return n, i.writeback(o, n)
 }
 
 // ReadAt implements the io.ReaderAt interface.
@@ -187,6 +193,7 @@ func (i *ringFIO) ReadAt(b []byte, o int64) (int, error) {
 	sqe.Flags = 0
 	sqe.Offset = uint64(o)
 	sqe.Addr = (uint64)(uintptr(unsafe.Pointer(&b[0])))
+	i.r.applyOpOptions(sqe, nil)
 
 	ready()
 
@@ -0,0 +1,104 @@
+// +build linux
+
+package iouring
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// TraceKind is the kind of entry in a ring trace.
+type TraceKind string
+
+const (
+	// TraceSubmit is a committed SubmitEntry.
+	TraceSubmit TraceKind = "sqe"
+	// TraceComplete is a reaped CompletionEntry.
+	TraceComplete TraceKind = "cqe"
+)
+
+// TraceRecord is a single entry of a ring trace, traces are written as JSON
+// lines (one record per line).
+type TraceRecord struct {
+	// Time is the time the entry was recorded in nanoseconds since the
+	// unix epoch.
+	Time int64            `json:"t"`
+	Kind TraceKind        `json:"k"`
+	SQE  *SubmitEntry     `json:"sqe,omitempty"`
+	CQE  *CompletionEntry `json:"cqe,omitempty"`
+}
+
+// recorder is used to serialize ring entries to a writer.
+type recorder struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+func newRecorder(w io.Writer) *recorder {
+	return &recorder{enc: json.NewEncoder(w)}
+}
+
+// submit records a SubmitEntry, it must be called before the entry is
+// available to the kernel.
+func (rec *recorder) submit(sqe *SubmitEntry) {
+	e := *sqe
+	rec.record(&TraceRecord{Kind: TraceSubmit, SQE: &e})
+}
+
+// complete records a CompletionEntry.
+func (rec *recorder) complete(cqe *CompletionEntry) {
+	e := *cqe
+	rec.record(&TraceRecord{Kind: TraceComplete, CQE: &e})
+}
+
+func (rec *recorder) record(t *TraceRecord) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	// Once the writer fails stop recording, a partial trace is still
+	// useful.
+	if rec.err != nil {
+		return
+	}
+	t.Time = time.Now().UnixNano()
+	rec.err = rec.enc.Encode(t)
+}
+
+// Err returns the first error returned from the underlying writer.
+func (rec *recorder) Err() error {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return rec.err
+}
+
+// TraceReader is used for reading a trace written by a Ring configured with
+// the WithRecorder option.
+type TraceReader struct {
+	dec *json.Decoder
+}
+
+// NewTraceReader returns a TraceReader.
+func NewTraceReader(r io.Reader) *TraceReader {
+	return &TraceReader{dec: json.NewDecoder(r)}
+}
+
+// Next returns the next TraceRecord, io.EOF is returned at the end of the
+// trace.
+func (t *TraceReader) Next() (*TraceRecord, error) {
+	var rec TraceRecord
+	if err := t.dec.Decode(&rec); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+// RecorderErr returns the first error encountered while writing a trace or
+// nil if the ring is not recording.
+func (r *Ring) RecorderErr() error {
+	if r.rec == nil {
+		return nil
+	}
+	return r.rec.Err()
+}
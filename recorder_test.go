@@ -0,0 +1,45 @@
+// +build linux
+
+package iouring
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithRecorder(t *testing.T) {
+	var buf bytes.Buffer
+	r, err := New(1024, nil, WithRecorder(&buf))
+	require.NoError(t, err)
+	require.NotNil(t, r)
+
+	require.NoError(t, r.Nop())
+	require.NoError(t, r.RecorderErr())
+
+	var (
+		sqes []*SubmitEntry
+		cqes []*CompletionEntry
+	)
+	tr := NewTraceReader(&buf)
+	for {
+		rec, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		require.NotZero(t, rec.Time)
+		switch rec.Kind {
+		case TraceSubmit:
+			sqes = append(sqes, rec.SQE)
+		case TraceComplete:
+			cqes = append(cqes, rec.CQE)
+		}
+	}
+	require.Len(t, sqes, 1)
+	require.Len(t, cqes, 1)
+	require.Equal(t, Nop, sqes[0].Opcode)
+	require.Equal(t, sqes[0].UserData, cqes[0].UserData)
+}
@@ -4,9 +4,13 @@ package iouring
 
 import (
 	"fmt"
+	"runtime"
 	"sync"
 	"syscall"
 	"unsafe"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
 )
 
 // RegisterEventFd is used to register an event file descriptor to a ring.
@@ -162,41 +166,225 @@ func ReregisterFiles(fd int, files []int) error {
 	return nil
 }
 
-// FileRegistry is an interface for registering files to a Ring.
+// FileRegistry is an interface for registering files to a Ring. Files are
+// registered in slots of the ring's registered file table, slots can also be
+// allocated for direct descriptors that have no file descriptor.
 type FileRegistry interface {
 	Register(int) error
 	Unregister(int) error
 	ID(int) (int, bool)
+	// AllocSlot is used to allocate a free slot for a direct
+	// descriptor.
+	AllocSlot() (int, error)
+	// ReleaseSlot is used to free a slot of a direct descriptor that has
+	// been closed.
+	ReleaseSlot(int)
+	// Update is used to replace the file in an allocated slot, a fd of -1
+	// empties the slot. The returned channel is closed once the kernel
+	// has released the previous file, files that weren't registered with
+	// a tag return a closed channel.
+	Update(slot int, fd int) (<-chan CompletionEntry, error)
 }
 
+const (
+	// fileTableSize is the maximum size of the registered file table, it
+	// is limited by RLIMIT_NOFILE.
+	fileTableSize = 1 << 16
+	// slotFree and slotDirect mark the slots that aren't used by a
+	// registered file descriptor.
+	slotFree   = -1
+	slotDirect = -2
+)
+
+// ErrNoFreeSlots is returned when the registered file table is full.
+var ErrNoFreeSlots = errors.New("no free slots in the registered file table")
+
 type fileRegistry struct {
 	mu     sync.RWMutex
 	ringFd int
-	f      []int
-	fID    map[int]int /* map of fd to offset */
+	// ring is used for watching tags, files are only registered with tags
+	// when it is set.
+	ring   *Ring
+	tagged bool
+	// slots holds the fd of each slot of the table, it is nil until the
+	// table is registered.
+	slots    []int
+	free     []int
+	released []<-chan CompletionEntry
+	fID      map[int]int /* map of fd to offset */
 }
 
-// NewFileRegistry creates a FileRegistry for use with a ring.
+// NewFileRegistry creates a FileRegistry for use with a ring. The sparse file
+// table is registered with the ring when the first slot is used.
 func NewFileRegistry(ringFd int) FileRegistry {
+	return newFileRegistry(ringFd, nil)
+}
+
+func newFileRegistry(ringFd int, ring *Ring) *fileRegistry {
 	return &fileRegistry{
 		ringFd: ringFd,
-		f:      []int{},
+		ring:   ring,
 		fID:    map[int]int{},
 	}
 }
 
+// alloc is used to allocate a slot, the lock must be held.
+func (r *fileRegistry) alloc() (int, error) {
+	if r.slots == nil {
+		if err := r.registerTable(fileTableLimit()); err != nil {
+			return -1, err
+		}
+	}
+	if len(r.free) == 0 {
+		return -1, ErrNoFreeSlots
+	}
+	slot := r.free[len(r.free)-1]
+	r.free = r.free[:len(r.free)-1]
+	return slot, nil
+}
+
+// release is used to free a slot, the lock must be held.
+func (r *fileRegistry) release(slot int) {
+	if slot < 0 || slot >= len(r.slots) || r.slots[slot] == slotFree {
+		return
+	}
+	r.slots[slot] = slotFree
+	r.released[slot] = nil
+	r.free = append(r.free, slot)
+}
+
+// issue is used to make a register call from the thread that is allowed to
+// issue requests to the ring.
+func (r *fileRegistry) issue(fn func() error) error {
+	if r.ring != nil {
+		return r.ring.issue(fn)
+	}
+	return fn()
+}
+
+// fileTableLimit returns the size of the registered file table, it is limited
+// by RLIMIT_NOFILE.
+func fileTableLimit() int {
+	n := fileTableSize
+	var lim unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_NOFILE, &lim); err == nil && lim.Cur < uint64(n) {
+		n = int(lim.Cur)
+	}
+	return n
+}
+
+// registerTable is used to register a sparse file table of up to n files, the
+// lock must be held.
+func (r *fileRegistry) registerTable(n int) error {
+	// Kernels before 5.15 limit the table to 1<<15 files and return EMFILE
+	// for larger tables, so the size is halved until the table fits.
+	if r.ring != nil {
+		var err error
+		for {
+			size := n
+			err = r.issue(func() error { return RegisterFilesSparse(r.ringFd, size) })
+			if err != syscall.EMFILE || n == 1 {
+				break
+			}
+			n /= 2
+		}
+		if err != nil && err != syscall.EINVAL {
+			return errors.Wrap(err, "failed to register file table")
+		}
+		// Older kernels don't support tags.
+		r.tagged = err == nil
+	}
+	for !r.tagged {
+		fds := make([]int32, n)
+		for i := range fds {
+			fds[i] = slotFree
+		}
+		err := r.issue(func() error {
+			_, _, errno := syscall.Syscall6(
+				RegisterSyscall,
+				uintptr(r.ringFd),
+				uintptr(RegRegisterFiles),
+				uintptr(unsafe.Pointer(&fds[0])),
+				uintptr(len(fds)),
+				uintptr(0),
+				uintptr(0),
+			)
+			if errno != 0 {
+				return errno
+			}
+			return nil
+		})
+		if err == nil {
+			break
+		}
+		if (err != syscall.EMFILE && err != syscall.EINVAL) || n == 1 {
+			return errors.Wrap(err, "failed to register file table")
+		}
+		n /= 2
+	}
+	r.slots = make([]int, n)
+	r.released = make([]<-chan CompletionEntry, n)
+	r.free = make([]int, n)
+	for i := range r.slots {
+		r.slots[i] = slotFree
+		// Allocate the lowest slots first.
+		r.free[i] = n - 1 - i
+	}
+	return nil
+}
+
 // Register implements the FileRegistry interface. It is used to register a
 // file descriptor with a ring.
 func (r *fileRegistry) Register(fd int) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	r.f = append(r.f, fd)
-	r.fID[fd] = len(r.f) - 1
-	if r.fID[fd] < 0 {
-		r.fID[fd] = 0
+	if _, ok := r.fID[fd]; ok {
+		return nil
+	}
+	slot, err := r.alloc()
+	if err != nil {
+		return err
+	}
+	if _, err := r.update(slot, fd); err != nil {
+		r.free = append(r.free, slot)
+		return err
 	}
-	return ReregisterFiles(r.ringFd, r.f)
+	r.slots[slot] = fd
+	r.fID[fd] = slot
+	return nil
+}
+
+// update is used to replace the file in a slot, it returns the channel of
+// the previous file. The lock must be held.
+func (r *fileRegistry) update(slot int, fd int) (<-chan CompletionEntry, error) {
+	prev := r.released[slot]
+	if prev == nil {
+		prev = released()
+	}
+	if !r.tagged {
+		err := r.issue(func() error { return UpdateFiles(r.ringFd, slot, []int32{int32(fd)}) })
+		if err != nil {
+			return nil, err
+		}
+		r.released[slot] = nil
+		return prev, nil
+	}
+	tag := uint64(0)
+	if fd >= 0 {
+		tag = r.ring.ID()
+	}
+	err := r.issue(func() error {
+		return UpdateFilesTagged(r.ringFd, slot, []int32{int32(fd)}, []uint64{tag})
+	})
+	if err != nil {
+		return nil, err
+	}
+	r.released[slot] = nil
+	if tag != 0 {
+		r.released[slot] = r.ring.watchTag(tag, nil)
+	}
+	return prev, nil
 }
 
 // Unregister implements the FileRegistry interface. It is used to unregister a
@@ -209,9 +397,12 @@ func (r *fileRegistry) Unregister(fd int) error {
 	if !ok {
 		return fmt.Errorf("fd %d not registered", fd)
 	}
-	r.f = append(r.f[:id], r.f[id+1:]...)
-
-	return UnregisterFiles(r.ringFd, r.f)
+	if _, err := r.update(id, slotFree); err != nil {
+		return err
+	}
+	delete(r.fID, fd)
+	r.release(id)
+	return nil
 }
 
 // ID returns the ID of a file descriptor that has been registered.
@@ -222,3 +413,79 @@ func (r *fileRegistry) ID(fd int) (int, bool) {
 	id, ok := r.fID[fd]
 	return id, ok
 }
+
+// AllocSlot implements the FileRegistry interface.
+func (r *fileRegistry) AllocSlot() (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	slot, err := r.alloc()
+	if err != nil {
+		return -1, err
+	}
+	r.slots[slot] = slotDirect
+	return slot, nil
+}
+
+// ReleaseSlot implements the FileRegistry interface.
+func (r *fileRegistry) ReleaseSlot(slot int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if slot >= 0 && slot < len(r.slots) && r.slots[slot] == slotDirect {
+		r.release(slot)
+	}
+}
+
+// Update implements the FileRegistry interface.
+func (r *fileRegistry) Update(slot int, fd int) (<-chan CompletionEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if slot < 0 || slot >= len(r.slots) || r.slots[slot] == slotFree {
+		return nil, syscall.EINVAL
+	}
+	prev, err := r.update(slot, fd)
+	if err != nil {
+		return nil, err
+	}
+	if old := r.slots[slot]; old >= 0 {
+		delete(r.fID, old)
+	}
+	r.slots[slot] = slotDirect
+	if fd >= 0 {
+		r.slots[slot] = fd
+		r.fID[fd] = slot
+	}
+	return prev, nil
+}
+
+// filesUpdate is the argument of a files update.
+type filesUpdate struct {
+	Offset uint32
+	Resv   uint32
+	Fds    uint64
+}
+
+// UpdateFiles is used to replace registered files starting at an offset, a fd
+// of -1 removes the file in the slot.
+func UpdateFiles(ringFd int, offset int, fds []int32) error {
+	up := filesUpdate{
+		Offset: uint32(offset),
+		Fds:    uint64(uintptr(unsafe.Pointer(&fds[0]))),
+	}
+	_, _, errno := syscall.Syscall6(
+		RegisterSyscall,
+		uintptr(ringFd),
+		uintptr(RegRegisterFilesUpdate),
+		uintptr(unsafe.Pointer(&up)),
+		uintptr(len(fds)),
+		uintptr(0),
+		uintptr(0),
+	)
+	runtime.KeepAlive(fds)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -9,6 +9,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
 )
 
 func TestRegisterBuffers(t *testing.T) {
@@ -40,3 +41,29 @@ func TestFileRegistry(t *testing.T) {
 	require.True(t, ok)
 	require.NoError(t, reg.Unregister(int(f.Fd())))
 }
+
+func TestFileRegistryTableSize(t *testing.T) {
+	var lim unix.Rlimit
+	require.NoError(t, unix.Getrlimit(unix.RLIMIT_NOFILE, &lim))
+	low := lim
+	low.Cur = 1 << 12
+	require.NoError(t, unix.Setrlimit(unix.RLIMIT_NOFILE, &low))
+	defer unix.Setrlimit(unix.RLIMIT_NOFILE, &lim)
+
+	// A table larger than the kernel allows is halved until it fits, with
+	// and without tags.
+	for _, tagged := range []bool{true, false} {
+		r, err := New(2048, nil)
+		require.NoError(t, err)
+		reg := newFileRegistry(r.Fd(), nil)
+		if tagged {
+			reg.ring = r
+		}
+		reg.mu.Lock()
+		require.NoError(t, reg.registerTable(fileTableSize))
+		reg.mu.Unlock()
+		require.Len(t, reg.slots, 1<<12)
+		require.Equal(t, tagged, reg.tagged)
+		require.NoError(t, r.Stop())
+	}
+}
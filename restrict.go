@@ -0,0 +1,131 @@
+// +build linux
+
+package iouring
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+const (
+	/*
+	 * io_uring_restriction->opcode values
+	 */
+
+	restrictionRegisterOp       = 0
+	restrictionSqeOp            = 1
+	restrictionSqeFlagsAllowed  = 2
+	restrictionSqeFlagsRequired = 3
+)
+
+// restriction is a struct io_uring_restriction.
+type restriction struct {
+	opcode uint16
+	arg    uint8
+	_      uint8
+	_      [3]uint32
+}
+
+// Restrictions is an allow list that the kernel enforces for a ring, anything
+// that isn't allowed fails with EACCES.
+type Restrictions struct {
+	// Opcodes are the allowed SQE opcodes.
+	Opcodes []Opcode
+	// RegisterOps are the allowed io_uring_register(2) opcodes (see
+	// RegRegisterBuffers etc).
+	RegisterOps []int
+	// SqeFlagsAllowed are the SQE flags that requests may set.
+	SqeFlagsAllowed uint8
+	// SqeFlagsRequired are the SQE flags that requests must set.
+	SqeFlagsRequired uint8
+}
+
+func (res Restrictions) entries() []restriction {
+	entries := make([]restriction, 0, len(res.Opcodes)+len(res.RegisterOps)+2)
+	for _, op := range res.Opcodes {
+		entries = append(entries, restriction{opcode: restrictionSqeOp, arg: uint8(op)})
+	}
+	for _, op := range res.RegisterOps {
+		entries = append(entries, restriction{opcode: restrictionRegisterOp, arg: uint8(op)})
+	}
+	entries = append(entries,
+		restriction{opcode: restrictionSqeFlagsAllowed, arg: res.SqeFlagsAllowed},
+		restriction{opcode: restrictionSqeFlagsRequired, arg: res.SqeFlagsRequired},
+	)
+	return entries
+}
+
+// RegisterRestrictions is used to register restrictions with a ring that was
+// created with SetupRDisabled.
+func RegisterRestrictions(ringFd int, res Restrictions) error {
+	entries := res.entries()
+	_, _, errno := syscall.Syscall6(
+		RegisterSyscall,
+		uintptr(ringFd),
+		uintptr(RegRegisterRestrictions),
+		uintptr(unsafe.Pointer(&entries[0])),
+		uintptr(len(entries)),
+		uintptr(0),
+		uintptr(0),
+	)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// EnableRings is used to enable a ring that was created with SetupRDisabled.
+func EnableRings(ringFd int) error {
+	_, _, errno := syscall.Syscall6(
+		RegisterSyscall,
+		uintptr(ringFd),
+		uintptr(RegRegisterEnableRings),
+		uintptr(0),
+		uintptr(0),
+		uintptr(0),
+		uintptr(0),
+	)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// NewRestricted is used to create a Ring that only allows what is in the
+// restrictions. The ring is created disabled, the restrictions are registered
+// and then the ring is enabled. ErrNotSupported is returned if the kernel
+// doesn't support restrictions.
+func NewRestricted(size uint, p *Params, res Restrictions, opts ...RingOption) (*Ring, error) {
+	if p == nil {
+		p = &Params{}
+	}
+	p.Flags |= SetupRDisabled
+	r, err := New(size, p, opts...)
+	if err == syscall.EINVAL && !setupSupported(SetupRDisabled) {
+		// Restrictions were added with SetupRDisabled, which older
+		// kernels reject.
+		return nil, ErrNotSupported
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := r.Restrict(res); err != nil {
+		r.Stop()
+		return nil, err
+	}
+	return r, nil
+}
+
+// Restrict is used to register restrictions and enable a ring that was
+// created with SetupRDisabled, the restrictions can only be registered once.
+func (r *Ring) Restrict(res Restrictions) error {
+	// The probe may not be allowed once the ring is enabled.
+	r.Probe()
+	if err := RegisterRestrictions(r.fd, res); err != nil {
+		if err == syscall.EINVAL && !setupSupported(SetupRDisabled) {
+			return ErrNotSupported
+		}
+		return err
+	}
+	return r.issue(func() error { return EnableRings(r.fd) })
+}
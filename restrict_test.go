@@ -0,0 +1,75 @@
+// +build linux
+
+package iouring
+
+import (
+	"io/ioutil"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRestricted(t *testing.T) {
+	r, err := NewRestricted(2048, nil, Restrictions{
+		Opcodes:         []Opcode{Nop, Write},
+		SqeFlagsAllowed: SqeAsync,
+	})
+	if err == ErrNotSupported {
+		t.Skip("restrictions not supported")
+	}
+	require.NoError(t, err)
+	require.NotNil(t, r)
+
+	require.NoError(t, r.Nop())
+	f, err := ioutil.TempFile("", "restrict")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+	require.Equal(t, syscall.EACCES, r.Fsync(int(f.Fd()), 0))
+
+	// Only the allowed flags may be used.
+	id, err := r.PrepareWrite(int(f.Fd()), []byte("test"), 0, SqeAsync)
+	require.NoError(t, err)
+	res, _ := r.complete(id)
+	require.Equal(t, int32(4), res)
+	id, err = r.PrepareWrite(int(f.Fd()), []byte("test"), 0, SqeIoDrain)
+	require.NoError(t, err)
+	res, _ = r.complete(id)
+	require.Equal(t, -int32(syscall.EACCES), res)
+
+	// No register opcodes are allowed.
+	_, err = r.RegisterPersonality()
+	require.Equal(t, syscall.EACCES, err)
+	// The probe was cached before the ring was enabled.
+	require.True(t, r.Supported(Nop))
+}
+
+func TestRingRestrict(t *testing.T) {
+	// Restrictions can only be registered on a disabled ring.
+	r, err := New(2048, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	require.Error(t, r.Restrict(Restrictions{Opcodes: []Opcode{Nop}}))
+
+	// Invalid restrictions aren't reported as unsupported.
+	r, err = New(2048, &Params{Flags: SetupRDisabled})
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	require.Equal(t, syscall.EINVAL, r.Restrict(Restrictions{Opcodes: []Opcode{255}}))
+	require.NoError(t, r.Stop())
+
+	r, err = New(2048, &Params{Flags: SetupRDisabled})
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	require.NoError(t, r.Restrict(Restrictions{
+		Opcodes:     []Opcode{Nop},
+		RegisterOps: []int{RegRegisterPersonality, RegUnregisterPersonality},
+	}))
+	require.NoError(t, r.Nop())
+	p, err := r.RegisterPersonality()
+	require.NoError(t, err)
+	require.NoError(t, r.UnregisterPersonality(p))
+	require.Error(t, r.Restrict(Restrictions{Opcodes: []Opcode{Nop}}))
+}
@@ -9,11 +9,20 @@ import (
 	"sync/atomic"
 	"syscall"
 	"time"
+	"unsafe"
 
 	"github.com/pkg/errors"
 	"golang.org/x/sys/unix"
 )
 
+const (
+	// wakeUserData is the user data of the poll on the wake eventfd.
+	wakeUserData = cqeConsumed - 1
+	// wakeFallback is how long the ring waits between reaping completions
+	// when the wake eventfd can't be polled.
+	wakeFallback = time.Millisecond
+)
+
 // Ring contains an io_uring submit and completion ring.
 type Ring struct {
 	fd              int
@@ -30,11 +39,51 @@ type Ring struct {
 	deadline        time.Duration
 	enterErrHandler func(error)
 	submitter       submitter
+	rec             *recorder
+	limiter         *rateLimiter
+	ioprio          IOPriority
+	worker          *lockedWorker
+	probeOnce       sync.Once
+	probe           *Probe
+	probeErr        error
+	multishotMu     sync.Mutex
+	multishotOps    map[Opcode]bool
+	bgids           groupIDs
+	connBufsOnce    sync.Once
+	connBufs        BufferGroup
+	connBufsErr     error
+	timersOnce      sync.Once
+	timers          *timerQueue
+	pins            sync.Map
+	npins           int32
+	exported        int32
+	// ringIndex is the index of the registered ring fd, it is only
+	// accessed by the worker thread.
+	ringIndex      int
+	ringRegistered bool
+	// registerFd is set by WithRegisteredRingFd, the ring fd is registered
+	// by the worker after all options have been applied.
+	registerFd bool
+	// deferred are the options that are applied once the ring is setup,
+	// see afterSetup.
+	deferred []RingOption
 
 	stop           chan struct{}
 	completions    chan *completionRequest
 	eventFd        int
 	completionPool sync.Pool
+	// exited is closed when run returns, it is nil if the ring is reaped
+	// by the worker.
+	exited chan struct{}
+	// wakeFd is an eventfd that is polled by the ring while waiting for
+	// completions, writing to it interrupts the wait. wakeArmed,
+	// wakeBroken and wakeTail are only accessed by the goroutine that reaps
+	// completions.
+	wakeFd     int
+	wakeArmed  bool
+	wakeBroken bool
+	wakeTail   uint32
+	waiting    int32
 }
 
 // New is used to create an iouring.Ring.
@@ -42,34 +91,75 @@ func New(size uint, p *Params, opts ...RingOption) (*Ring, error) {
 	if p == nil {
 		p = &Params{}
 	}
+	// The options are applied before the ring is setup so they can set
+	// setup flags, options that need the ring are applied by init.
+	r := allocRing(p)
+	if err := r.apply(opts); err != nil {
+		return nil, err
+	}
+	// A single issuer ring is enabled by the thread that issues requests.
+	enable := p.Flags&SetupSingleIssuer != 0 && p.Flags&SetupRDisabled == 0
+	if enable {
+		p.Flags |= SetupRDisabled
+	}
 	fd, err := Setup(size, p)
+	if err == syscall.EINVAL {
+		if flags := unsupportedSetupFlags(p.Flags); flags != 0 {
+			return nil, errors.Wrapf(ErrNotSupported, "setup flags %#x", flags)
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
 	var (
-		cq       CompletionQueue
-		sq       SubmitQueue
-		sqWrites uint32
+		cq CompletionQueue
+		sq SubmitQueue
 	)
 	if err := MmapRing(fd, p, &sq, &cq); err != nil {
 		return nil, err
 	}
-	idx := uint64(0)
-	entered := uint32(0)
-	sq.entered = &entered
+	if err := r.init(fd, &sq, &cq); err != nil {
+		return nil, err
+	}
+	if !enable {
+		return r, nil
+	}
+	// The probe can't be registered by other threads once the ring is
+	// enabled.
+	r.Probe()
+	if err := r.issue(func() error { return EnableRings(fd) }); err != nil {
+		r.Stop()
+		return nil, err
+	}
+	p.Flags &^= SetupRDisabled
+	return r, nil
+}
 
-	sq.writes = &sqWrites
-	r := &Ring{
-		p:           p,
-		fd:          fd,
-		cq:          &cq,
-		sq:          &sq,
-		idx:         &idx,
-		fileReg:     nil,
-		eventFd:     -1,
-		stop:        make(chan struct{}, 32),
-		completions: make(chan *completionRequest, len(cq.Entries)),
-		c:           newCompleter(&cq, 512),
+// newRing is used to create a Ring from a ring file descriptor that has been
+// mmap'd.
+func newRing(fd int, p *Params, sq *SubmitQueue, cq *CompletionQueue, opts []RingOption) (*Ring, error) {
+	r := allocRing(p)
+	r.fd = fd
+	if err := r.apply(opts); err != nil {
+		return nil, err
+	}
+	if err := r.init(fd, sq, cq); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// allocRing returns a Ring that hasn't been setup, see init.
+func allocRing(p *Params) *Ring {
+	idx := uint64(0)
+	return &Ring{
+		p:       p,
+		fd:      -1,
+		idx:     &idx,
+		fileReg: nil,
+		eventFd: -1,
+		wakeFd:  -1,
+		stop:    make(chan struct{}, 32),
 		completionPool: sync.Pool{
 			New: func() interface{} {
 				return &completionRequest{
@@ -78,15 +168,54 @@ func New(size uint, p *Params, opts ...RingOption) (*Ring, error) {
 			},
 		},
 	}
+}
+
+// apply is used to apply options to the ring.
+func (r *Ring) apply(opts []RingOption) error {
 	for _, opt := range opts {
 		if err := opt(r); err != nil {
-			return nil, err
+			return err
 		}
 	}
-	go r.run()
-	go r.c.run()
+	return nil
+}
 
-	return r, nil
+// init is used to start a ring once its queues have been mmap'd, the options
+// that were deferred until the ring was setup are applied.
+func (r *Ring) init(fd int, sq *SubmitQueue, cq *CompletionQueue) error {
+	entered := uint32(0)
+	sqWrites := uint32(0)
+	sq.entered = &entered
+	sq.writes = &sqWrites
+	r.fd = fd
+	r.sq = sq
+	r.cq = cq
+	r.completions = make(chan *completionRequest, cq.Len())
+	r.c = newCompleter(cq, 512)
+	if fd, err := unix.Eventfd(0, unix.EFD_NONBLOCK|unix.EFD_CLOEXEC); err == nil {
+		r.wakeFd = fd
+	}
+	deferred := r.deferred
+	r.deferred = nil
+	if err := r.apply(deferred); err != nil {
+		return err
+	}
+	if (r.p.Flags&SetupSingleIssuer != 0 || r.registerFd) && r.worker == nil {
+		if err := WithLockedThread()(r); err != nil {
+			return err
+		}
+	}
+	if r.registerFd {
+		if err := r.worker.do(r.registerRingFd); err != nil {
+			return err
+		}
+	}
+	if r.worker == nil {
+		r.exited = make(chan struct{})
+		go r.run()
+	}
+	go r.c.run()
+	return nil
 }
 
 // CQ returns the CompletionQueue for the ring.
@@ -105,72 +234,188 @@ func (r *Ring) EventFd() int {
 	return r.eventFd
 }
 
-// Enter is used to enter the ring.
+// Enter is used to enter the ring. When the ring was configured with
+// WithLockedThread the ring is entered by the worker thread.
 func (r *Ring) Enter(toSubmit uint, minComplete uint, flags uint, sigset *unix.Sigset_t) (int, error) {
+	if r.worker != nil {
+		return r.worker.enter(toSubmit, minComplete, flags, sigset)
+	}
+	return r.enter(toSubmit, minComplete, flags, sigset)
+}
+
+// enter is used to enter the ring from the calling goroutine.
+func (r *Ring) enter(toSubmit uint, minComplete uint, flags uint, sigset *unix.Sigset_t) (int, error) {
 	// Acquire the submit barrier so that the ring can safely be entered.
 	if r.sq.NeedWakeup() {
 		flags |= EnterSqWakeup
 	}
+	if r.p.Flags&SetupDeferTaskrun != 0 || r.sq.TaskrunPending() {
+		// Completions are only posted when getting events.
+		flags |= EnterGetEvents
+	}
 	// Increase the write counter as the caller will be
-	// updating the returned SubmitEntry.
-	r.sq.enterLock()
+	// updating the returned SubmitEntry. Entries aren't read when nothing is
+	// submitted, so waiting for completions doesn't block the writers.
+	if toSubmit > 0 {
+		r.sq.enterLock()
+		defer r.sq.enterUnlock()
+	}
 	// TODO: Document how sigset should be used in relation with the go runtime and
 	// io_uring_enter.
-	completed, err := Enter(r.fd, toSubmit, minComplete, flags, sigset)
-	r.sq.enterUnlock()
-	return completed, err
+	fd := r.fd
+	if r.ringRegistered {
+		fd = r.ringIndex
+		flags |= EnterRegisteredRing
+	}
+	return Enter(fd, toSubmit, minComplete, flags, sigset)
 }
 
 // run is used to run the ring and handle completions.
 func (r *Ring) run() {
+	defer close(r.exited)
 	inflight := map[uint64]*completionRequest{}
-	retry := make(chan struct{}, 2)
 	for {
-		select {
-		case <-r.stop:
-			return
-		case cr := <-r.completions:
-			inflight[cr.id] = cr
-			// TODO: Use the number completed for tracking
-			count, err := r.Enter(uint(len(inflight)), 0, EnterGetEvents, nil)
-			if err != nil {
-				if r.enterErrHandler != nil {
-					r.enterErrHandler(err)
-				}
-				// There still may be completed requests so continue on.
-			}
-			r.onEntry(inflight, count)
-			if len(inflight) > 0 {
-				retry <- struct{}{}
+		if len(inflight) == 0 {
+			// Nothing is in flight, wait for a request.
+			select {
+			case <-r.stop:
+				return
+			case cr := <-r.completions:
+				inflight[cr.id] = cr
 			}
-		case <-retry:
+		}
+	requests:
+		for {
 			select {
+			case <-r.stop:
+				return
 			case cr := <-r.completions:
 				inflight[cr.id] = cr
-				_, err := r.Enter(uint(len(inflight)), 0, EnterGetEvents, nil)
-				if err != nil {
-					if r.enterErrHandler != nil {
-						r.enterErrHandler(err)
-					}
-				}
 			default:
+				break requests
 			}
-			r.onEntry(inflight, 0)
-			if len(inflight) > 0 {
-				// TODO: Use eventfd for polling instead.
-				time.Sleep(200 * time.Nanosecond)
-				retry <- struct{}{}
-			}
 		}
+		r.reap(inflight, r.idle)
+	}
+}
+
+// idle returns if run has nothing to do but wait for completions.
+func (r *Ring) idle() bool {
+	return len(r.completions) == 0 && len(r.stop) == 0
+}
+
+// reap is used to submit the pending entries and deliver the completions of
+// the inflight requests. When idle returns true it waits for a completion,
+// wake interrupts the wait.
+func (r *Ring) reap(inflight map[uint64]*completionRequest, idle func() bool) {
+	minComplete := uint(0)
+	canWake := r.armWake()
+	// The poll of the wake eventfd is submitted before waiting.
+	toSubmit := r.toSubmit()
+	if canWake {
+		// idle must be checked after wake can see the wait.
+		atomic.StoreInt32(&r.waiting, 1)
+		if idle() {
+			minComplete = 1
+		}
+	}
+	var err error
+	if toSubmit > 0 && minComplete > 0 {
+		// Submit first so that the wait doesn't hold the submit queue.
+		_, err = r.enter(toSubmit, 0, EnterGetEvents, nil)
+		toSubmit = 0
+	}
+	if err == nil {
+		_, err = r.enter(toSubmit, minComplete, EnterGetEvents, nil)
+	}
+	atomic.StoreInt32(&r.waiting, 0)
+	if err != nil && err != syscall.EINTR && r.enterErrHandler != nil {
+		r.enterErrHandler(err)
+	}
+	r.onEntry(inflight, 0)
+	if !canWake && len(inflight) > 0 && idle() {
+		time.Sleep(wakeFallback)
+	}
+}
+
+// armWake is used to poll the wake eventfd, it returns false if the ring
+// can't be woken while waiting for completions.
+func (r *Ring) armWake() bool {
+	if r.wakeFd < 0 || r.wakeBroken {
+		return false
+	}
+	if r.wakeArmed {
+		return r.wakeSubmitted()
+	}
+	sqe := r.nextEntry()
+	if sqe == nil {
+		return false
+	}
+	sqe.Opcode = PollAdd
+	sqe.Fd = int32(r.wakeFd)
+	sqe.UFlags = int32(POLLIN)
+	sqe.UserData = wakeUserData
+	// The poll is internal so it isn't recorded.
+	r.sq.completeWrite()
+	r.wakeArmed = true
+	r.wakeTail = atomic.LoadUint32(r.sq.Tail)
+	if r.submitter != nil {
+		// Submit the poll with the batch so the batch isn't flushed
+		// early.
+		r.submitter.submit(wakeUserData)
+		return r.wakeSubmitted()
+	}
+	return true
+}
+
+// wakeSubmitted returns if the kernel has read the poll of the wake eventfd,
+// without batching it is submitted by reap.
+func (r *Ring) wakeSubmitted() bool {
+	return r.submitter == nil || int32(atomic.LoadUint32(r.sq.Head)-r.wakeTail) >= 0
+}
+
+// woken is used to reset the wake eventfd once its poll has completed.
+func (r *Ring) woken(res int32) {
+	r.wakeArmed = false
+	if res < 0 && res != -int32(syscall.ECANCELED) {
+		// The poll isn't permitted, such as by the restrictions of
+		// the ring.
+		r.wakeBroken = true
+		return
+	}
+	var b [8]byte
+	syscall.Read(r.wakeFd, b[:])
+}
+
+// wake is used to interrupt reap waiting for completions.
+func (r *Ring) wake() {
+	if atomic.CompareAndSwapInt32(&r.waiting, 1, 0) {
+		v := uint64(1)
+		syscall.Write(r.wakeFd, (*[8]byte)(unsafe.Pointer(&v))[:])
 	}
 }
 
+// request is used to hand a request to the goroutine that reaps completions.
+func (r *Ring) request(cr *completionRequest) {
+	r.completions <- cr
+	r.wake()
+}
+
+// toSubmit returns the number of entries to submit when entering the ring to
+// get completions, when a submitter is configured it handles submissions.
+func (r *Ring) toSubmit() uint {
+	if r.submitter != nil {
+		return 0
+	}
+	return r.sqPending()
+}
+
 func (r *Ring) complete(reqID uint64) (int32, uint32) {
 	req := r.completionPool.Get().(*completionRequest)
 	req.id = reqID
 	req.res = 0
 	req.flags = 0
-	r.completions <- req
+	r.request(req)
 	<-req.done
 	res := req.res
 	flags := req.flags
@@ -178,47 +423,111 @@ func (r *Ring) complete(reqID uint64) (int32, uint32) {
 	return res, flags
 }
 
+// WaitBig is used to wait for the completion of a request that was prepared
+// with a Prepare function, the extra data is zero unless the ring was setup
+// with SetupCQE32.
+func (r *Ring) WaitBig(id uint64) BigCompletionEntry {
+	req := r.completionPool.Get().(*completionRequest)
+	req.id = id
+	req.res = 0
+	req.flags = 0
+	req.big = [2]uint64{}
+	r.request(req)
+	<-req.done
+	cqe := BigCompletionEntry{
+		CompletionEntry: CompletionEntry{UserData: id, Res: req.res, Flags: req.flags},
+		Big:             req.big,
+	}
+	r.completionPool.Put(req)
+	return cqe
+}
+
 func (r *Ring) onEntry(inflight map[uint64]*completionRequest, count int) {
 	mask := atomic.LoadUint32(r.cq.Mask)
 	head := atomic.LoadUint32(r.cq.Head)
 	tail := atomic.LoadUint32(r.cq.Tail)
-	nEntries := uint32(len(r.cq.Entries))
 	seenIdx := uint32(0)
 	seen := true
-	for i := head & mask; i < nEntries; i++ {
-		cqe := r.cq.Entries[i]
-		if cr, ok := inflight[cqe.UserData]; ok {
+	// Only the entries between the head and the tail are posted, a
+	// consumed entry at the tail must not move the head past the tail.
+	for i := head; i != tail; i++ {
+		if r.dispatch(inflight, r.cq.Entry(i&mask)) {
 			if seen {
 				seenIdx++
 			}
-			cr.res = cqe.Res
-			cr.flags = cqe.Flags
-			cr.done <- struct{}{}
-			delete(inflight, cr.id)
 		} else {
 			seen = false
 		}
-		if i == tail&mask {
-			atomic.StoreUint32(r.cq.Head, head+seenIdx)
-			return
-		}
 	}
-	seen = true
-	for i := uint32(0); i < tail&mask; i++ {
-		cqe := r.cq.Entries[i]
-		if cr, ok := inflight[cqe.UserData]; ok {
-			if seen {
-				seenIdx++
-			}
-			cr.res = cqe.Res
-			cr.flags = cqe.Flags
-			cr.done <- struct{}{}
+	atomic.StoreUint32(r.cq.Head, head+seenIdx)
+}
+
+// dispatch is used to deliver a CQE to an inflight request, it returns true
+// if the CQE has been consumed.
+func (r *Ring) dispatch(inflight map[uint64]*completionRequest, e *CompletionEntry) bool {
+	if e.UserData == cqeConsumed {
+		return true
+	}
+	if e.UserData == wakeUserData {
+		e.UserData = cqeConsumed
+		r.woken(e.Res)
+		return true
+	}
+	cr, ok := inflight[e.UserData]
+	if !ok {
+		return false
+	}
+	cqe := *e
+	if r.rec != nil {
+		r.rec.complete(&cqe)
+	}
+	r.reaped(&cqe)
+	if cr.stream != nil || cr.bigStream != nil {
+		big := BigCompletionEntry{CompletionEntry: cqe}
+		if b := r.cq.Big(e); b != nil && cr.bigStream != nil {
+			big.Big = *b
+		}
+		// The head can't move past this entry until the entries
+		// before it are consumed, mark it so it isn't delivered
+		// again.
+		e.UserData = cqeConsumed
+		r.deliver(inflight, cr, big)
+		if cqe.Flags&CqeFMore == 0 {
 			delete(inflight, cr.id)
-		} else {
-			seen = false
 		}
+		return true
+	}
+	cr.res = cqe.Res
+	cr.flags = cqe.Flags
+	if big := r.cq.Big(e); big != nil {
+		cr.big = *big
+	}
+	// The waiter reuses the request once done is signaled.
+	delete(inflight, cr.id)
+	cr.done <- struct{}{}
+	return true
+}
+
+// pin is used to keep memory that is referenced by a SubmitEntry alive until
+// the ring reaps its completion.
+func (r *Ring) pin(id uint64, v interface{}) {
+	atomic.AddInt32(&r.npins, 1)
+	r.pins.Store(id, v)
+}
+
+// reaped is used to release the memory pinned for a request once its last
+// completion is reaped, every path that reaps completions must call it.
+func (r *Ring) reaped(cqe *CompletionEntry) {
+	if atomic.LoadInt32(&r.npins) > 0 && cqe.Flags&CqeFMore == 0 {
+		r.unpin(cqe.UserData)
+	}
+}
+
+func (r *Ring) unpin(id uint64) {
+	if _, ok := r.pins.Load(id); ok {
+		r.pins.Delete(id)
+		atomic.AddInt32(&r.npins, -1)
 	}
-	atomic.StoreUint32(r.cq.Head, head+seenIdx)
 }
 
 // getCqe is used for getting a CQE result.
@@ -231,9 +540,10 @@ findCqe:
 	mask := atomic.LoadUint32(cq.Mask)
 	end := int(tail & mask)
 
-	for x := int(head & mask); x < len(cq.Entries); x++ {
-		cqe := cq.Entries[x]
+	for x := int(head & mask); x < int(cq.Len()); x++ {
+		cqe := *cq.Entry(uint32(x))
 		if cqe.UserData == reqID {
+			r.reaped(&cqe)
 			if cqe.Res < 0 {
 				return 0, 0, syscall.Errno(-cqe.Res)
 			}
@@ -248,8 +558,9 @@ findCqe:
 	mask = atomic.LoadUint32(cq.Mask)
 	end = int(tail & mask)
 	for x := 0; x < end; x++ {
-		cqe := cq.Entries[x]
+		cqe := *cq.Entry(uint32(x))
 		if cqe.UserData == reqID {
+			r.reaped(&cqe)
 			if cqe.Res < 0 {
 				return 0, 0, syscall.Errno(-cqe.Res)
 			}
@@ -281,6 +592,13 @@ func (r *Ring) NeedsEnter() bool {
 
 // Stop is used to stop the ring.
 func (r *Ring) Stop() error {
+	if r.submitter != nil {
+		r.submitter.stop()
+	}
+	if r.worker != nil {
+		r.worker.stop()
+	}
+	r.stopRun()
 	if err := r.closeSq(); err != nil {
 		return err
 	}
@@ -289,12 +607,26 @@ func (r *Ring) Stop() error {
 			return err
 		}
 	}
-	if r.submitter != nil {
-		r.submitter.stop()
+	if r.wakeFd >= 0 {
+		syscall.Close(r.wakeFd)
+		r.wakeFd = -1
 	}
 	return syscall.Close(r.fd)
 }
 
+// stopRun is used to stop reaping completions, it waits for run to return so
+// the queues aren't accessed after they are unmapped.
+func (r *Ring) stopRun() {
+	select {
+	case r.stop <- struct{}{}:
+	default:
+	}
+	r.wake()
+	if r.exited != nil {
+		<-r.exited
+	}
+}
+
 func (r *Ring) closeCq() error {
 	r.cqMu.Lock()
 	defer r.cqMu.Unlock()
@@ -374,33 +706,102 @@ func (r *Ring) SubmitEntry() (*SubmitEntry, func()) {
 	// This function roughly follows this:
 	// https://github.com/axboe/liburing/blob/master/src/queue.c#L258
 
+	if atomic.LoadInt32(&r.exported) != 0 {
+		// The ring is owned by the importer.
+		return nil, nil
+	}
+getNext:
+	sqe := r.nextEntry()
+	if sqe == nil {
+		// The ring is full, submit the pending entries to make room.
+		r.Enter(r.sqPending(), 0, 0, nil)
+		goto getNext
+	}
+	return sqe, func() {
+		if r.limiter == nil {
+			r.commitEntry(sqe)
+			return
+		}
+		c := r.limiter.charge(sqe)
+		r.commitEntry(sqe)
+		if r.limiter.delay(c) <= 0 {
+			return
+		}
+		// Submit the committed entries so that the other classes
+		// aren't held behind them while waiting.
+		if n := r.toSubmit(); n > 0 {
+			r.Enter(n, 0, 0, nil)
+		}
+		r.limiter.wait(c)
+	}
+}
+
+// sqPending returns the number of entries that haven't been submitted.
+func (r *Ring) sqPending() uint {
+	return uint(atomic.LoadUint32(r.sq.Tail) - atomic.LoadUint32(r.sq.Head))
+}
+
+// nextEntry is used to reserve the next SubmitEntry without entering the ring,
+// it returns nil if the SubmitQueue is full. The entry must be committed with
+// commitEntry.
+func (r *Ring) nextEntry() *SubmitEntry {
 getNext:
+	// Register as a writer before checking if the ring is being entered,
+	// enterLock waits for all writers so the kernel never reads a
+	// partially written entry.
+	atomic.AddUint32(r.sq.writes, 1)
+	if atomic.LoadUint32(r.sq.entered) != 0 {
+		r.sq.completeWrite()
+		runtime.Gosched()
+		goto getNext
+	}
 	tail := atomic.LoadUint32(r.sq.Tail)
 	head := atomic.LoadUint32(r.sq.Head)
 	mask := atomic.LoadUint32(r.sq.Mask)
-	next := tail&mask + 1
-	if next <= uint32(len(r.sq.Entries)) {
-		// Make sure the ring is safe for updating by acquring the
-		// update barrier.
-		if !atomic.CompareAndSwapUint32(r.sq.Tail, tail, next) {
-			runtime.Gosched()
-			goto getNext
-		}
-		if atomic.LoadUint32(r.sq.entered) != 0 {
-			runtime.Gosched()
-			goto getNext
-		}
-		atomic.AddUint32(r.sq.writes, 1)
+	if tail-head >= r.sq.Len() {
+		r.sq.completeWrite()
+		return nil
+	}
+	// Make sure the ring is safe for updating by acquring the update
+	// barrier.
+	if !atomic.CompareAndSwapUint32(r.sq.Tail, tail, tail+1) {
+		r.sq.completeWrite()
+		runtime.Gosched()
+		goto getNext
+	}
 
-		r.sq.Entries[tail&mask].Reset()
-		return &r.sq.Entries[tail&mask], func() {
-			r.sq.completeWrite()
-			r.sq.Array[next-1] = head & mask
-		}
+	idx := tail & mask
+	r.sq.Array[idx] = idx
+	sqe := r.sq.Entry(idx)
+	sqe.Reset()
+	if r.sq.shift == 1 {
+		// Reset only clears the first 64 bytes of a 128 byte entry.
+		r.sq.Entries[idx<<1+1] = SubmitEntry{}
 	}
-	// When the ring wraps restart.
-	atomic.CompareAndSwapUint32(r.sq.Tail, tail, 0)
-	goto getNext
+	return sqe
+}
+
+// commitEntry is used to make an entry from nextEntry ready for submission.
+func (r *Ring) commitEntry(sqe *SubmitEntry) {
+	if r.rec != nil {
+		r.rec.submit(sqe)
+	}
+	r.sq.completeWrite()
+	if r.submitter != nil {
+		r.submitter.submit(sqe.UserData)
+		return
+	}
+	// The entry is submitted by the goroutine that reaps completions.
+	r.wake()
+}
+
+// SubmitStats returns statistics for batched submissions, it returns zero
+// values if the ring wasn't configured with a batching option.
+func (r *Ring) SubmitStats() SubmitStats {
+	if r.submitter == nil {
+		return SubmitStats{}
+	}
+	return r.submitter.stats()
 }
 
 // ID returns an id for a SQEs, it is a monotonically increasing value (until
@@ -421,12 +822,13 @@ func (r *Ring) FileRegistry() FileRegistry {
 
 // FileReadWriter returns an io.ReadWriter from an os.File that uses the ring.
 // Note that is is not valid to use other operations on the file (Seek/Close)
-// in combination with the reader.
-func (r *Ring) FileReadWriter(f *os.File) (ReadWriteSeekerCloser, error) {
-	return r.fileReadWriter(f)
+// in combination with the reader. The returned value also implements
+// FileAllocator.
+func (r *Ring) FileReadWriter(f *os.File, opts ...FileOption) (ReadWriteSeekerCloser, error) {
+	return r.fileReadWriter(f, opts...)
 }
 
-func (r *Ring) fileReadWriter(f *os.File) (*ringFIO, error) {
+func (r *Ring) fileReadWriter(f *os.File, opts ...FileOption) (*ringFIO, error) {
 	var offset int64
 	o, err := f.Seek(0, 0)
 	if err != nil {
@@ -440,6 +842,9 @@ func (r *Ring) fileReadWriter(f *os.File) (*ringFIO, error) {
 		fOffset: &offset,
 		c:       r.c,
 	}
+	for _, opt := range opts {
+		opt(rw)
+	}
 	if r.fileReg == nil {
 		return rw, nil
 	}
@@ -202,3 +202,29 @@ func BenchmarkRingDeadlineWrite(b *testing.B) {
 		)
 	}
 }
+
+func BenchmarkNopRegisteredRingFd(b *testing.B) {
+	tests := []struct {
+		name string
+		opts []RingOption
+	}{
+		{name: "unregistered", opts: []RingOption{WithLockedThread()}},
+		{name: "registered", opts: []RingOption{WithLockedThread(), WithRegisteredRingFd()}},
+	}
+	for _, test := range tests {
+		b.Run(test.name, func(b *testing.B) {
+			r, err := New(2048, nil, test.opts...)
+			require.NoError(b, err)
+			require.NotNil(b, r)
+			defer r.Stop()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := r.Nop(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ package iouring
 
 import (
 	"context"
+	"io"
 	"net"
 	"runtime"
 	"sync"
@@ -25,12 +26,55 @@ type ringConn struct {
 	poll      chan uint64
 	pollReady *int32
 
+	// readMu serializes reads, the reader owns recv and its draining.
+	readMu sync.Mutex
+	// recvMu guards recv and its request so Close can cancel a read
+	// that is waiting for data.
+	recvMu    sync.Mutex
+	recv      *connRecv
+	closeOnce sync.Once
+	closed    chan struct{}
+
 	deadMu        sync.RWMutex
 	deadline      time.Time
 	readDeadline  time.Time
 	writeDeadline time.Time
 }
 
+const (
+	// connRecvBuffers is the number of buffers provided for the
+	// connections of a ring using multishot receives.
+	connRecvBuffers = 128
+	// connRecvBufferSize is the size of each receive buffer.
+	connRecvBufferSize = 4096
+	// connRecvRetry is how long a reader waits before receiving again
+	// when the connections of the ring have used all of the buffers.
+	connRecvRetry = time.Millisecond
+)
+
+// connRecv is used for receiving on a connection with a multishot recv.
+type connRecv struct {
+	ms *Multishot
+	// bg is shared by the connections of the ring, see Ring.connBuffers.
+	bg BufferGroup
+	// buf is the unread part of the current buffer.
+	buf  []byte
+	bid  uint16
+	held bool
+	// starved is set when the request was terminated as there were no
+	// buffers.
+	starved bool
+}
+
+// connBuffers returns the buffer group that is shared by the connections of
+// the ring for multishot receives.
+func (r *Ring) connBuffers() (BufferGroup, error) {
+	r.connBufsOnce.Do(func() {
+		r.connBufs, r.connBufsErr = r.NewBufferGroup(connRecvBuffers, connRecvBufferSize)
+	})
+	return r.connBufs, r.connBufsErr
+}
+
 // getCqe is used for getting a CQE result.
 func (c *ringConn) getCqe(ctx context.Context, reqID uint64) (int, error) {
 	// TODO: Where should this repoll go?
@@ -57,6 +101,10 @@ func (c *ringConn) getCqe(ctx context.Context, reqID uint64) (int, error) {
 		}
 		break
 	}
+	c.r.reaped(cqe)
+	if c.r.rec != nil {
+		c.r.rec.complete(cqe)
+	}
 	res := int(cqe.Res)
 	if res < 0 {
 		return 0, syscall.Errno(-res)
@@ -69,11 +117,13 @@ func (c *ringConn) rePoll() {
 	// Reenable the poll on the connection.
 	id := c.r.ID()
 	sqe, commit := c.r.SubmitEntry()
-	sqe.Opcode = PollAdd
-	sqe.Fd = int32(c.fd)
-	sqe.UFlags = int32(POLLIN)
-	sqe.UserData = id
-	commit()
+	if sqe != nil {
+		sqe.Opcode = PollAdd
+		sqe.Fd = int32(c.fd)
+		sqe.UFlags = int32(POLLIN)
+		sqe.UserData = id
+		commit()
+	}
 	c.r.Enter(uint(1024), uint(1), EnterGetEvents, nil)
 }
 
@@ -83,6 +133,9 @@ func (c *ringConn) run() {
 		case <-c.stop:
 			id := c.r.ID()
 			sqe, commit := c.r.SubmitEntry()
+			if sqe == nil {
+				return
+			}
 			sqe.Opcode = PollRemove
 			sqe.Fd = int32(c.fd)
 			sqe.UserData = id
@@ -95,6 +148,9 @@ func (c *ringConn) run() {
 
 // Read implements the net.Conn interface.
 func (c *ringConn) Read(b []byte) (int, error) {
+	if c.r.MultishotSupported(Recv) {
+		return c.readMultishot(b)
+	}
 	c.rePoll()
 	sqe, commit := c.r.SubmitEntry()
 	if sqe == nil {
@@ -118,6 +174,94 @@ func (c *ringConn) Read(b []byte) (int, error) {
 	return n, err
 }
 
+// readMultishot is used to read from the connection using a multishot recv,
+// received data is buffered in a provided buffer until it has been read.
+func (c *ringConn) readMultishot(b []byte) (int, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+	if c.isClosed() {
+		c.closeRecv()
+		return 0, errConnClosed
+	}
+	if c.recv == nil {
+		bg, err := c.r.connBuffers()
+		if err != nil {
+			return 0, err
+		}
+		ms, err := c.r.RecvMultishot(c.fd, bg.ID(), 0)
+		if err != nil {
+			return 0, err
+		}
+		c.recvMu.Lock()
+		c.recv = &connRecv{ms: ms, bg: bg}
+		c.recvMu.Unlock()
+	}
+	rv := c.recv
+	for len(rv.buf) == 0 {
+		if rv.held {
+			rv.held = false
+			if err := rv.bg.Release(rv.bid); err != nil {
+				return 0, err
+			}
+		}
+		cqe, ok := <-rv.ms.C
+		if !ok {
+			// The kernel terminated the request, this happens
+			// when it runs out of buffers or Close canceled it.
+			if rv.starved {
+				// Wait for the other connections to return
+				// buffers.
+				rv.starved = false
+				time.Sleep(connRecvRetry)
+			}
+			c.recvMu.Lock()
+			if c.isClosed() {
+				c.recvMu.Unlock()
+				c.closeRecv()
+				return 0, errConnClosed
+			}
+			ms, err := c.r.RecvMultishot(c.fd, rv.bg.ID(), 0)
+			if err == nil {
+				rv.ms = ms
+			}
+			c.recvMu.Unlock()
+			if err != nil {
+				return 0, err
+			}
+			continue
+		}
+		if cqe.Res < 0 {
+			if c.isClosed() {
+				c.closeRecv()
+				return 0, errConnClosed
+			}
+			switch syscall.Errno(-cqe.Res) {
+			case syscall.ENOBUFS:
+				rv.starved = true
+				continue
+			case syscall.ECANCELED:
+				// The request was terminated, it is rearmed
+				// once C is closed.
+				continue
+			}
+			return 0, syscall.Errno(-cqe.Res)
+		}
+		if cqe.Res == 0 {
+			return 0, io.EOF
+		}
+		bid, ok := CqeBufferID(&cqe)
+		if !ok {
+			return 0, errors.New("recv completed without a buffer")
+		}
+		rv.bid = bid
+		rv.held = true
+		rv.buf = rv.bg.Buffer(bid)[:cqe.Res]
+	}
+	n := copy(b, rv.buf)
+	rv.buf = rv.buf[n:]
+	return n, nil
+}
+
 // Write implements the net.Conn interface.
 func (c *ringConn) Write(b []byte) (n int, err error) {
 	sqe, commit := c.r.SubmitEntry()
@@ -140,10 +284,58 @@ func (c *ringConn) Write(b []byte) (n int, err error) {
 	return n, err
 }
 
+// isClosed returns if Close has been called.
+func (c *ringConn) isClosed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// closeRecv is used by the reader to wait for the recv request to finish
+// and remove its buffers, readMu must be held.
+func (c *ringConn) closeRecv() {
+	c.recvMu.Lock()
+	rv := c.recv
+	c.recv = nil
+	c.recvMu.Unlock()
+	if rv == nil {
+		return
+	}
+	rv.ms.Cancel()
+	// The buffers are shared by the connections of the ring so the ones
+	// that weren't read are returned.
+	if rv.held {
+		rv.bg.Release(rv.bid)
+	}
+	for cqe := range rv.ms.C {
+		if bid, ok := CqeBufferID(&cqe); ok {
+			rv.bg.Release(bid)
+		}
+	}
+}
+
 // Close implements the net.Conn interface.
 func (c *ringConn) Close() error {
-	c.stop <- struct{}{}
-	return syscall.Close(c.fd)
+	err := errConnClosed
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		// Cancel the recv request to wake a reader that is waiting
+		// for data, the reader drains it.
+		c.recvMu.Lock()
+		if rv := c.recv; rv != nil {
+			rv.ms.Cancel()
+		}
+		c.recvMu.Unlock()
+		c.readMu.Lock()
+		c.closeRecv()
+		c.readMu.Unlock()
+		c.stop <- struct{}{}
+		err = syscall.Close(c.fd)
+	})
+	return err
 }
 
 // LocalAddr implements the net.Conn interface.
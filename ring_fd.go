@@ -0,0 +1,102 @@
+// +build linux
+
+package iouring
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// rsrcUpdate is used for registering ring fds.
+type rsrcUpdate struct {
+	Offset uint32
+	Resv   uint32
+	Data   uint64
+}
+
+// RegisterRingFd is used to register a ring fd with the calling thread, the
+// returned index can be used in place of the fd when entering with
+// EnterRegisteredRing. The index is only valid on the thread that registered
+// it.
+func RegisterRingFd(ringFd int) (int, error) {
+	up := rsrcUpdate{
+		// Let the kernel pick the index.
+		Offset: ^uint32(0),
+		Data:   uint64(ringFd),
+	}
+	_, _, errno := syscall.Syscall6(
+		RegisterSyscall,
+		uintptr(ringFd),
+		uintptr(RegRegisterRingFds),
+		uintptr(unsafe.Pointer(&up)),
+		uintptr(1),
+		uintptr(0),
+		uintptr(0),
+	)
+	if errno != 0 {
+		return -1, errno
+	}
+	return int(up.Offset), nil
+}
+
+// UnregisterRingFd is used to unregister a ring fd index of the calling
+// thread.
+func UnregisterRingFd(ringFd int, index int) error {
+	up := rsrcUpdate{Offset: uint32(index)}
+	_, _, errno := syscall.Syscall6(
+		RegisterSyscall,
+		uintptr(ringFd),
+		uintptr(RegUnregisterRingFds),
+		uintptr(unsafe.Pointer(&up)),
+		uintptr(1),
+		uintptr(0),
+		uintptr(0),
+	)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// registerRingFd is used to register the ring fd, it must be called by the
+// worker thread.
+func (r *Ring) registerRingFd() error {
+	if r.ringRegistered {
+		return nil
+	}
+	idx, err := RegisterRingFd(r.fd)
+	if err == syscall.EINVAL {
+		// Registering ring fds isn't supported.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	r.ringIndex = idx
+	r.ringRegistered = true
+	return nil
+}
+
+// unregisterRingFd is used to unregister the ring fd, it must be called by
+// the worker thread.
+func (r *Ring) unregisterRingFd() {
+	if !r.ringRegistered {
+		return
+	}
+	UnregisterRingFd(r.fd, r.ringIndex)
+	r.ringRegistered = false
+}
+
+// RingFdRegistered returns if the ring is entered using a registered ring
+// fd.
+func (r *Ring) RingFdRegistered() bool {
+	if r.worker == nil {
+		return false
+	}
+	var ok bool
+	r.worker.do(func() error {
+		ok = r.ringRegistered
+		return nil
+	})
+	return ok
+}
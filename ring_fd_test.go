@@ -0,0 +1,61 @@
+// +build linux
+
+package iouring
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterRingFd(t *testing.T) {
+	r, err := New(8, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	defer r.Stop()
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	idx, err := RegisterRingFd(r.Fd())
+	if err != nil {
+		t.Skipf("registered ring fds not supported: %v", err)
+	}
+	_, err = Enter(idx, 0, 0, EnterRegisteredRing, nil)
+	require.NoError(t, err)
+	require.NoError(t, UnregisterRingFd(r.Fd(), idx))
+	_, err = Enter(idx, 0, 0, EnterRegisteredRing, nil)
+	require.Error(t, err)
+}
+
+func TestWithRegisteredRingFd(t *testing.T) {
+	r, err := New(2048, nil, WithRegisteredRingFd())
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	require.NotNil(t, r.worker)
+	if !r.RingFdRegistered() {
+		t.Skip("registered ring fds not supported")
+	}
+
+	for i := 0; i < 100; i++ {
+		require.NoError(t, r.Nop())
+	}
+	require.NoError(t, r.Stop())
+}
+
+func TestWithRegisteredRingFdLockedThread(t *testing.T) {
+	// The ring fd is registered by the worker of a later WithLockedThread.
+	r, err := New(2048, nil, WithRegisteredRingFd(), WithLockedThread(0))
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	require.NotNil(t, r.worker)
+	require.Equal(t, []int{0}, r.worker.cpus)
+	if !r.RingFdRegistered() {
+		t.Skip("registered ring fds not supported")
+	}
+	require.NoError(t, r.Nop())
+	require.NoError(t, r.Stop())
+
+	_, err = New(2048, nil, WithLockedThread(), WithLockedThread())
+	require.Error(t, err)
+}
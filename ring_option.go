@@ -3,14 +3,29 @@
 package iouring
 
 import (
+	"io"
 	"time"
 
+	"github.com/pkg/errors"
 	"golang.org/x/sys/unix"
 )
 
-// RingOption is an option for configuring a Ring.
+// RingOption is an option for configuring a Ring. Options are applied
+// before the ring is setup, see afterSetup for options that need the ring.
 type RingOption func(*Ring) error
 
+// afterSetup is used to wrap an option that needs the ring to be setup, the
+// option is applied once the queues of the ring have been mmap'd.
+func afterSetup(opt RingOption) RingOption {
+	return func(r *Ring) error {
+		if r.cq == nil {
+			r.deferred = append(r.deferred, opt)
+			return nil
+		}
+		return opt(r)
+	}
+}
+
 // WithDebug is used to print additional debug information.
 func WithDebug() RingOption {
 	return func(r *Ring) error {
@@ -22,7 +37,7 @@ func WithDebug() RingOption {
 // WithEventFd is used to create an eventfd and register it to the Ring.
 // The event fd can be accessed using the EventFd method.
 func WithEventFd(initval uint, flags int, async bool) RingOption {
-	return func(r *Ring) error {
+	return afterSetup(func(r *Ring) error {
 		fd, err := unix.Eventfd(initval, flags)
 		if err != nil {
 			return err
@@ -32,16 +47,17 @@ func WithEventFd(initval uint, flags int, async bool) RingOption {
 			return RegisterEventFdAsync(r.fd, fd)
 		}
 		return RegisterEventFd(r.fd, fd)
-	}
+	})
 }
 
 // WithFileRegistry is used to register a FileRegistry with the Ring. The
-// registery can be accessed with the FileRegistry method on the ring.
+// registery can be accessed with the FileRegistry method on the ring. Files
+// are registered with tags when the kernel supports them.
 func WithFileRegistry() RingOption {
-	return func(r *Ring) error {
-		r.fileReg = NewFileRegistry(r.fd)
+	return afterSetup(func(r *Ring) error {
+		r.fileReg = newFileRegistry(r.fd, r)
 		return nil
-	}
+	})
 }
 
 // WithID is used to set the starting id for the monotonically increasing ID
@@ -61,14 +77,86 @@ func WithEnterErrHandler(f func(error)) RingOption {
 	}
 }
 
-// WithDeadline is used to configure the deadline for submitting IO.
+// WithDeadline is used to configure the deadline for submitting IO. It is
+// the same as WithBatching with a default batch size.
 func WithDeadline(d time.Duration) RingOption {
-	return func(r *Ring) error {
-		r.deadline = d
-		s := newRingSubmitter(r, d)
+	return WithBatching(defaultBatchSize, d)
+}
+
+// WithBatching is used to batch submissions, the ring is entered when
+// batchSize entries have been committed or the deadline is reached. The
+// deadline adapts to the rate of submissions and maxDeadline is the upper
+// bound, when submissions are infrequent they are submitted immediately.
+// Statistics are available with the SubmitStats method.
+func WithBatching(batchSize int, maxDeadline time.Duration) RingOption {
+	return afterSetup(func(r *Ring) error {
+		r.deadline = maxDeadline
+		s := newRingSubmitter(r, batchSize, maxDeadline)
 		// This is an ugly hack....
 		go s.run()
 		r.submitter = s
 		return nil
+	})
+}
+
+// WithRecorder is used to record every committed SubmitEntry and reaped
+// CompletionEntry to a writer as JSON lines. The trace can be read with a
+// TraceReader and replayed with the iouring-replay command.
+func WithRecorder(w io.Writer) RingOption {
+	return func(r *Ring) error {
+		r.rec = newRecorder(w)
+		return nil
+	}
+}
+
+// WithRateLimit is used to limit the rate of IO submitted to the ring. Reads,
+// writes and all other operations are each limited to iops operations and
+// bytesPerSec bytes per second, a value of zero or less disables the limit.
+// Committing a SubmitEntry charges the limit of its class and the committer is
+// delayed until the limit allows it, the other classes aren't delayed.
+func WithRateLimit(iops int, bytesPerSec int64) RingOption {
+	return func(r *Ring) error {
+		r.limiter = newRateLimiter(iops, bytesPerSec)
+		return nil
+	}
+}
+
+// WithDefaultIOPriority is used to set the IO priority of read and write
+// requests that don't set a priority with the WithIOPriority option.
+func WithDefaultIOPriority(p IOPriority) RingOption {
+	return func(r *Ring) error {
+		r.ioprio = p
+		return nil
+	}
+}
+
+// WithLockedThread is used to enter the ring and reap completions from a
+// single goroutine that is locked to an OS thread. Callers of Enter hand off
+// to the worker through a lock-free queue rather than contending to enter the
+// ring. If cpus are given the worker thread's CPU affinity is set to them.
+// It may only be used once for a ring.
+func WithLockedThread(cpus ...int) RingOption {
+	return afterSetup(func(r *Ring) error {
+		if r.worker != nil {
+			return errors.New("ring already has a locked thread")
+		}
+		w := newLockedWorker(r, cpus)
+		if err := w.start(); err != nil {
+			return err
+		}
+		r.worker = w
+		return nil
+	})
+}
+
+// WithRegisteredRingFd is used to register the ring fd so that entering the
+// ring skips looking up the fd on each io_uring_enter call. Registered ring
+// fds belong to a thread, so the ring is entered by a locked worker, see
+// WithLockedThread, which is started if no option started one. It is ignored
+// if the kernel doesn't support registering ring fds.
+func WithRegisteredRingFd() RingOption {
+	return func(r *Ring) error {
+		r.registerFd = true
+		return nil
 	}
 }
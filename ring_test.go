@@ -3,9 +3,12 @@
 package iouring
 
 import (
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
 )
 
 func TestNew(t *testing.T) {
@@ -40,3 +43,60 @@ func TestNewRingInvalidSize(t *testing.T) {
 	_, err := New(99999, nil)
 	require.Error(t, err)
 }
+
+func cpuTime(t *testing.T) time.Duration {
+	var ru syscall.Rusage
+	require.NoError(t, syscall.Getrusage(syscall.RUSAGE_SELF, &ru))
+	return time.Duration(ru.Utime.Nano() + ru.Stime.Nano())
+}
+
+// requireIdle checks that the process doesn't use the CPU, the least busy of a
+// few intervals ignores the rest of the process.
+func requireIdle(t *testing.T) {
+	idle := time.Duration(1<<63 - 1)
+	for i := 0; i < 3; i++ {
+		start := cpuTime(t)
+		time.Sleep(200 * time.Millisecond)
+		if d := cpuTime(t) - start; d < idle {
+			idle = d
+		}
+	}
+	require.True(t, idle < time.Millisecond, "busy for %v", idle)
+}
+
+func TestRingIdle(t *testing.T) {
+	r, err := New(2048, nil)
+	require.NoError(t, err)
+	defer r.Stop()
+	testRingIdle(t, r)
+}
+
+// testRingIdle checks that the ring doesn't use the CPU while waiting for
+// completions.
+func testRingIdle(t *testing.T, r *Ring) {
+	var fds [2]int
+	require.NoError(t, unix.Pipe(fds[:]))
+	defer unix.Close(fds[0])
+	defer unix.Close(fds[1])
+
+	timer, err := r.NewTimer(time.Hour)
+	require.NoError(t, err)
+	defer timer.Stop()
+	ms, err := r.PollMultishot(fds[0], unix.POLLIN)
+	require.NoError(t, err)
+
+	// The ring must wait in the kernel while requests are in flight.
+	requireIdle(t)
+
+	// Requests submitted while waiting are still handled.
+	require.NoError(t, r.Nop())
+	_, err = unix.Write(fds[1], []byte{1})
+	require.NoError(t, err)
+	select {
+	case cqe := <-ms.C:
+		require.True(t, cqe.Res > 0)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the poll")
+	}
+	require.NoError(t, ms.Cancel())
+}
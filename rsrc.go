@@ -0,0 +1,252 @@
+// +build linux
+
+package iouring
+
+import (
+	"os"
+	"runtime"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"github.com/pkg/errors"
+)
+
+// rsrcRegister is the argument of a tagged registration.
+type rsrcRegister struct {
+	Nr    uint32
+	Flags uint32
+	Resv2 uint64
+	Data  uint64
+	Tags  uint64
+}
+
+// rsrcUpdate2 is the argument of a tagged update.
+type rsrcUpdate2 struct {
+	Offset uint32
+	Resv   uint32
+	Data   uint64
+	Tags   uint64
+	Nr     uint32
+	Resv2  uint32
+}
+
+// registerRsrc is used to register a table of resources with tags.
+func registerRsrc(ringFd int, op int, nr int, flags uint32, data unsafe.Pointer, tags []uint64) error {
+	reg := rsrcRegister{
+		Nr:    uint32(nr),
+		Flags: flags,
+		Data:  uint64(uintptr(data)),
+	}
+	if len(tags) > 0 {
+		reg.Tags = uint64(uintptr(unsafe.Pointer(&tags[0])))
+	}
+	_, _, errno := syscall.Syscall6(
+		RegisterSyscall,
+		uintptr(ringFd),
+		uintptr(op),
+		uintptr(unsafe.Pointer(&reg)),
+		unsafe.Sizeof(reg),
+		uintptr(0),
+		uintptr(0),
+	)
+	runtime.KeepAlive(tags)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// updateRsrc is used to replace resources with tags starting at an offset.
+func updateRsrc(ringFd int, op int, offset int, nr int, data unsafe.Pointer, tags []uint64) error {
+	up := rsrcUpdate2{
+		Offset: uint32(offset),
+		Data:   uint64(uintptr(data)),
+		Nr:     uint32(nr),
+	}
+	if len(tags) > 0 {
+		up.Tags = uint64(uintptr(unsafe.Pointer(&tags[0])))
+	}
+	_, _, errno := syscall.Syscall6(
+		RegisterSyscall,
+		uintptr(ringFd),
+		uintptr(op),
+		uintptr(unsafe.Pointer(&up)),
+		unsafe.Sizeof(up),
+		uintptr(0),
+		uintptr(0),
+	)
+	runtime.KeepAlive(tags)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// RegisterFilesTagged is used to register files with tags, a CQE with the tag
+// as the user data is posted when the kernel releases a file. A tag of zero
+// doesn't post a CQE.
+func RegisterFilesTagged(ringFd int, fds []int32, tags []uint64) error {
+	err := registerRsrc(ringFd, RegRegisterFiles2, len(fds), 0, unsafe.Pointer(&fds[0]), tags)
+	runtime.KeepAlive(fds)
+	return err
+}
+
+// RegisterFilesSparse is used to register a table of n empty file slots.
+func RegisterFilesSparse(ringFd int, n int) error {
+	return registerRsrc(ringFd, RegRegisterFiles2, n, RsrcRegisterSparse, nil, nil)
+}
+
+// UpdateFilesTagged is used to replace registered files starting at an
+// offset, a fd of -1 empties the slot.
+func UpdateFilesTagged(ringFd int, offset int, fds []int32, tags []uint64) error {
+	err := updateRsrc(ringFd, RegRegisterFilesUpdate2, offset, len(fds), unsafe.Pointer(&fds[0]), tags)
+	runtime.KeepAlive(fds)
+	return err
+}
+
+// RegisterBuffersTagged is used to register buffers with tags, a CQE with the
+// tag as the user data is posted when the kernel releases a buffer. A tag of
+// zero doesn't post a CQE.
+func RegisterBuffersTagged(ringFd int, iovecs []syscall.Iovec, tags []uint64) error {
+	err := registerRsrc(ringFd, RegRegisterBuffers2, len(iovecs), 0, unsafe.Pointer(&iovecs[0]), tags)
+	runtime.KeepAlive(iovecs)
+	return err
+}
+
+// RegisterBuffersSparse is used to register a table of n empty buffer slots.
+func RegisterBuffersSparse(ringFd int, n int) error {
+	return registerRsrc(ringFd, RegRegisterBuffers2, n, RsrcRegisterSparse, nil, nil)
+}
+
+// UpdateBuffersTagged is used to replace registered buffers starting at an
+// offset, an empty iovec empties the slot.
+func UpdateBuffersTagged(ringFd int, offset int, iovecs []syscall.Iovec, tags []uint64) error {
+	err := updateRsrc(ringFd, RegRegisterBuffersUpdate, offset, len(iovecs), unsafe.Pointer(&iovecs[0]), tags)
+	runtime.KeepAlive(iovecs)
+	return err
+}
+
+// released returns a closed channel for slots that don't have a resource.
+func released() <-chan CompletionEntry {
+	c := make(chan CompletionEntry)
+	close(c)
+	return c
+}
+
+// watchTag is used to watch for the release of a registered resource, the
+// value is kept alive until the kernel releases the resource. The tag CQE is
+// sent on the returned channel and the channel is closed. A tag CQE that
+// arrives before the tag is watched stays in the CompletionQueue until it is.
+func (r *Ring) watchTag(tag uint64, v interface{}) <-chan CompletionEntry {
+	if v != nil {
+		r.pin(tag, v)
+	}
+	c := make(chan CompletionEntry, 1)
+	r.request(&completionRequest{
+		id:     tag,
+		stream: c,
+	})
+	return c
+}
+
+// BufferRegistry is a table of registered buffers for ReadFixed and
+// WriteFixed requests, the index of a buffer is its slot. Buffers are
+// registered with tags so it is known when the kernel has released them.
+type BufferRegistry struct {
+	r        *Ring
+	mu       sync.Mutex
+	released []<-chan CompletionEntry
+	bufs     [][]byte
+}
+
+// NewBufferRegistry is used to register a sparse table of n buffer slots.
+// ErrNotSupported is returned if the kernel doesn't support tagged buffers.
+func (r *Ring) NewBufferRegistry(n int) (*BufferRegistry, error) {
+	if err := r.issue(func() error { return RegisterBuffersSparse(r.fd, n) }); err != nil {
+		if err == syscall.EINVAL {
+			return nil, ErrNotSupported
+		}
+		return nil, errors.Wrap(err, "failed to register buffer table")
+	}
+	return &BufferRegistry{
+		r:        r,
+		released: make([]<-chan CompletionEntry, n),
+		bufs:     make([][]byte, n),
+	}, nil
+}
+
+// Len returns the number of slots.
+func (b *BufferRegistry) Len() int {
+	return len(b.released)
+}
+
+// Update is used to replace the buffer in a slot, an empty buffer empties the
+// slot. The buffer is kept alive until the kernel releases it. The returned
+// channel receives the tag CQE and is closed once the kernel has released
+// the previous buffer, which is after the requests using it complete, only
+// then is it safe to reuse the previous buffer's memory.
+func (b *BufferRegistry) Update(slot int, buf []byte) (<-chan CompletionEntry, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if slot < 0 || slot >= len(b.released) {
+		return nil, syscall.EINVAL
+	}
+	iov := []syscall.Iovec{{}}
+	tags := []uint64{0}
+	if len(buf) > 0 {
+		iov[0].Base = &buf[0]
+		iov[0].SetLen(len(buf))
+		tags[0] = b.r.ID()
+	}
+	err := b.r.issue(func() error { return UpdateBuffersTagged(b.r.fd, slot, iov, tags) })
+	if err != nil {
+		return nil, err
+	}
+	prev := b.released[slot]
+	if prev == nil {
+		prev = released()
+	}
+	b.released[slot] = nil
+	b.bufs[slot] = nil
+	if tags[0] != 0 {
+		b.released[slot] = b.r.watchTag(tags[0], buf)
+		b.bufs[slot] = buf
+	}
+	return prev, nil
+}
+
+// Advise is used to madvise the buffer in a slot, for example MADV_DONTNEED
+// when it is no longer used or MADV_WILLNEED before it is. Only the pages that
+// lie entirely within the buffer are advised so the neighbouring memory isn't
+// affected, buffers should be page aligned such as ones from mmap.
+func (b *BufferRegistry) Advise(slot int, advice int) error {
+	b.mu.Lock()
+	if slot < 0 || slot >= len(b.bufs) {
+		b.mu.Unlock()
+		return syscall.EINVAL
+	}
+	buf := b.bufs[slot]
+	b.mu.Unlock()
+
+	page := uintptr(os.Getpagesize())
+	start := uintptr(0)
+	if len(buf) > 0 {
+		start = uintptr(unsafe.Pointer(&buf[0]))
+	}
+	off := int((page - start%page) % page)
+	if off >= len(buf) {
+		return nil
+	}
+	n := (len(buf) - off) / int(page) * int(page)
+	if n == 0 {
+		return nil
+	}
+	return b.r.Madvise(buf[off:off+n], advice)
+}
+
+// Unregister is used to empty a slot, see Update.
+func (b *BufferRegistry) Unregister(slot int) (<-chan CompletionEntry, error) {
+	return b.Update(slot, nil)
+}
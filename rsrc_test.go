@@ -0,0 +1,169 @@
+// +build linux
+
+package iouring
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func requireReleased(t *testing.T, c <-chan CompletionEntry) {
+	select {
+	case <-c:
+	case <-time.After(time.Second):
+		t.Fatal("resource not released")
+	}
+}
+
+func requireNotReleased(t *testing.T, c <-chan CompletionEntry) {
+	select {
+	case <-c:
+		t.Fatal("resource released")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestBufferRegistry(t *testing.T) {
+	r, err := New(2048, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	defer r.Stop()
+
+	reg, err := r.NewBufferRegistry(4)
+	if err == ErrNotSupported {
+		t.Skip(err)
+	}
+	require.NoError(t, err)
+	require.Equal(t, 4, reg.Len())
+
+	var p [2]int
+	require.NoError(t, unix.Pipe(p[:]))
+	defer unix.Close(p[0])
+	defer unix.Close(p[1])
+
+	buf := make([]byte, 4)
+	c, err := reg.Update(0, buf)
+	require.NoError(t, err)
+	// The slot was empty.
+	requireReleased(t, c)
+
+	// The read holds the buffer until it completes.
+	id, err := r.PrepareReadFixed(p[0], buf, 0)
+	require.NoError(t, err)
+	// Submit the read before the buffer is replaced.
+	_, err = r.Enter(r.toSubmit(), 0, 0, nil)
+	require.NoError(t, err)
+	done := make(chan error, 1)
+	go func() {
+		_, err := r.wait(id)
+		done <- err
+	}()
+	c, err = reg.Update(0, make([]byte, 4))
+	require.NoError(t, err)
+	requireNotReleased(t, c)
+
+	_, err = unix.Write(p[1], []byte("test"))
+	require.NoError(t, err)
+	require.NoError(t, <-done)
+	require.Equal(t, "test", string(buf))
+	requireReleased(t, c)
+
+	c, err = reg.Unregister(0)
+	require.NoError(t, err)
+	requireReleased(t, c)
+
+	_, err = reg.Update(4, buf)
+	require.Error(t, err)
+}
+
+func TestFileRegistryUpdate(t *testing.T) {
+	r, err := New(2048, nil, WithFileRegistry())
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	defer r.Stop()
+	reg := r.FileRegistry()
+
+	var p [2]int
+	require.NoError(t, unix.Pipe(p[:]))
+	defer unix.Close(p[0])
+	defer unix.Close(p[1])
+
+	slot, err := reg.AllocSlot()
+	require.NoError(t, err)
+	c, err := reg.Update(slot, p[1])
+	require.NoError(t, err)
+	requireReleased(t, c)
+	id, ok := reg.ID(p[1])
+	require.True(t, ok)
+	require.Equal(t, slot, id)
+
+	wid, err := r.PrepareWrite(slot, []byte("test"), 0, 0, WithFixedFile())
+	require.NoError(t, err)
+	n, err := r.wait(wid)
+	require.NoError(t, err)
+	require.Equal(t, int32(4), n)
+	b := make([]byte, 4)
+	_, err = unix.Read(p[0], b)
+	require.NoError(t, err)
+	require.Equal(t, "test", string(b))
+
+	c, err = reg.Update(slot, -1)
+	require.NoError(t, err)
+	if reg.(*fileRegistry).tagged {
+		cqe, ok := <-c
+		require.True(t, ok)
+		require.NotZero(t, cqe.UserData)
+	}
+	requireReleased(t, c)
+	_, ok = reg.ID(p[1])
+	require.False(t, ok)
+	reg.ReleaseSlot(slot)
+
+	_, err = reg.Update(slot, p[1])
+	require.Error(t, err)
+}
+
+func TestBufferRegistryAdvise(t *testing.T) {
+	r, err := New(2048, nil)
+	require.NoError(t, err)
+	defer r.Stop()
+
+	reg, err := r.NewBufferRegistry(2)
+	if err == ErrNotSupported {
+		t.Skip(err)
+	}
+	require.NoError(t, err)
+
+	page := os.Getpagesize()
+	mem, err := unix.Mmap(-1, 0, 2*page, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_ANON|unix.MAP_PRIVATE)
+	require.NoError(t, err)
+	defer unix.Munmap(mem)
+	_, err = reg.Update(0, mem)
+	require.NoError(t, err)
+
+	require.NoError(t, reg.Advise(0, unix.MADV_WILLNEED))
+	copy(mem[page:], "test")
+	require.NoError(t, reg.Advise(0, unix.MADV_DONTNEED))
+	require.Equal(t, make([]byte, 4), mem[page:page+4])
+
+	// Only the pages within an unaligned buffer are advised.
+	buf := make([]byte, 3*page)
+	for i := range buf {
+		buf[i] = 0xaa
+	}
+	_, err = reg.Update(1, buf[1:len(buf)-1])
+	require.NoError(t, err)
+	require.NoError(t, reg.Advise(1, unix.MADV_DONTNEED))
+	require.Equal(t, byte(0xaa), buf[1])
+	require.Equal(t, byte(0xaa), buf[len(buf)-2])
+
+	require.Equal(t, syscall.EINVAL, reg.Advise(2, unix.MADV_DONTNEED))
+	_, err = reg.Unregister(0)
+	require.NoError(t, err)
+	require.NoError(t, reg.Advise(0, unix.MADV_DONTNEED))
+}
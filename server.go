@@ -0,0 +1,732 @@
+// +build linux
+
+package iouring
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// defaultServerRingSize is the size of the ring used by each loop.
+	defaultServerRingSize = 1024
+	// defaultServerBuffers is the number of receive buffers for each loop.
+	defaultServerBuffers = 256
+	// defaultServerBufferSize is the size of each receive buffer.
+	defaultServerBufferSize = 4096
+	// serverRecvRetry is how long a loop waits before receiving on the
+	// connections that ran out of buffers if no buffer is returned.
+	serverRecvRetry = time.Millisecond
+)
+
+var (
+	errConnClosed = errors.New("connection closed")
+)
+
+// EventHandler handles the events of connections accepted by a Server.
+// Handlers are called from the event loop that owns the connection and must
+// not block.
+type EventHandler interface {
+	// OnOpen is called when a connection is accepted.
+	OnOpen(c *ServerConn)
+	// OnData is called when data is received, b is only valid until OnData
+	// returns.
+	OnData(c *ServerConn, b []byte)
+	// OnWritable is called when all data written to the connection has been
+	// sent.
+	OnWritable(c *ServerConn)
+	// OnClose is called when the connection is closed, err is nil if the
+	// connection was closed by the peer or with Close.
+	OnClose(c *ServerConn, err error)
+}
+
+// ServerOption is an option for configuring a Server.
+type ServerOption func(*Server) error
+
+// WithLoops is used to set the number of event loops, each loop has its own
+// ring. The default is the number of CPUs.
+func WithLoops(n int) ServerOption {
+	return func(s *Server) error {
+		if n < 1 {
+			return errors.New("invalid number of loops")
+		}
+		s.nLoops = n
+		return nil
+	}
+}
+
+// WithServerRing is used to configure the ring used by each loop.
+func WithServerRing(size uint, opts ...RingOption) ServerOption {
+	return func(s *Server) error {
+		s.ringSize = size
+		s.ringOpts = opts
+		return nil
+	}
+}
+
+// WithServerBuffers is used to configure the buffer group used for receiving
+// by each loop.
+func WithServerBuffers(n int, size int) ServerOption {
+	return func(s *Server) error {
+		s.buffers = n
+		s.bufferSize = size
+		return nil
+	}
+}
+
+// WithServerSockopts is used to set socket options (SOReuseport,
+// TCPFastopen) on the listening socket.
+func WithServerSockopts(sockopts ...int) ServerOption {
+	return func(s *Server) error {
+		s.sockopts = sockopts
+		return nil
+	}
+}
+
+// Server is an event loop based server. Accepted connections are spread
+// across the loops and events are delivered to an EventHandler.
+type Server struct {
+	h          EventHandler
+	fd         int
+	a          *addr
+	loops      []*serverLoop
+	nLoops     int
+	ringSize   uint
+	ringOpts   []RingOption
+	buffers    int
+	bufferSize int
+	sockopts   []int
+	next       int
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+	mu       sync.Mutex
+	started  bool
+	closed   bool
+	err      error
+}
+
+// NewServer returns a Server listening on the address, Serve must be called
+// to start handling connections.
+func NewServer(network, address string, h EventHandler, opts ...ServerOption) (*Server, error) {
+	s := &Server{
+		h:          h,
+		nLoops:     runtime.NumCPU(),
+		ringSize:   defaultServerRingSize,
+		buffers:    defaultServerBuffers,
+		bufferSize: defaultServerBufferSize,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, err
+		}
+	}
+
+	fd, a, err := listenSocket(network, address, s.sockopts...)
+	if err != nil {
+		return nil, err
+	}
+	s.fd = fd
+	s.a = a
+
+	for i := 0; i < s.nLoops; i++ {
+		l, err := newServerLoop(s, i)
+		if err != nil {
+			s.release()
+			return nil, err
+		}
+		s.loops = append(s.loops, l)
+	}
+	return s, nil
+}
+
+// Addr returns the address the server is listening on.
+func (s *Server) Addr() net.Addr {
+	return s.a
+}
+
+// Serve is used to run the event loops, it returns after the server is
+// closed.
+func (s *Server) Serve() error {
+	s.mu.Lock()
+	if s.started || s.closed {
+		s.mu.Unlock()
+		return errors.New("server already started")
+	}
+	s.started = true
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, l := range s.loops {
+		wg.Add(1)
+		go func(l *serverLoop) {
+			defer wg.Done()
+			if err := l.run(); err != nil {
+				s.setErr(err)
+				s.signalStop()
+			}
+		}(l)
+	}
+	wg.Wait()
+	close(s.done)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Close is used to stop the server, all connections are closed.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	started := s.started
+	s.mu.Unlock()
+
+	s.signalStop()
+	if started {
+		<-s.done
+	}
+	return s.release()
+}
+
+func (s *Server) signalStop() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+}
+
+func (s *Server) setErr(err error) {
+	s.mu.Lock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.mu.Unlock()
+}
+
+// release is used to close the listening socket and the rings.
+func (s *Server) release() error {
+	err := syscall.Close(s.fd)
+	for _, l := range s.loops {
+		if bErr := l.bg.Close(); bErr != nil && err == nil {
+			err = bErr
+		}
+		if rErr := l.r.Stop(); rErr != nil && err == nil {
+			err = rErr
+		}
+	}
+	return err
+}
+
+// assign is used to give an accepted connection to a loop.
+func (s *Server) assign(from *serverLoop, fd int) {
+	l := s.loops[s.next%len(s.loops)]
+	s.next++
+	if l == from {
+		l.open(fd)
+		return
+	}
+	l.fds <- fd
+}
+
+// ServerConn is a connection that is owned by a Server event loop. Its
+// methods must only be called from the EventHandler.
+type ServerConn struct {
+	l      *serverLoop
+	fd     int
+	laddr  *addr
+	raddr  *addr
+	ctx    interface{}
+	closed bool
+	// recvArmed is set while a recv request is in flight.
+	recvArmed bool
+	// sending is set while a send request is in flight, only one send is
+	// in flight so a short write is completed before the next write.
+	sending bool
+	// pending are the writes that are queued behind the in flight send.
+	pending [][]byte
+	// starved is set while the connection waits for a receive buffer.
+	starved bool
+}
+
+// Fd returns the file descriptor of the connection.
+func (c *ServerConn) Fd() int {
+	return c.fd
+}
+
+// LocalAddr returns the local address of the connection.
+func (c *ServerConn) LocalAddr() net.Addr {
+	return c.laddr
+}
+
+// RemoteAddr returns the remote address of the connection.
+func (c *ServerConn) RemoteAddr() net.Addr {
+	return c.raddr
+}
+
+// Context returns the user defined context of the connection.
+func (c *ServerConn) Context() interface{} {
+	return c.ctx
+}
+
+// SetContext is used to set a user defined context on the connection.
+func (c *ServerConn) SetContext(ctx interface{}) {
+	c.ctx = ctx
+}
+
+// Write is used to queue data to be sent, OnWritable is called after all
+// queued data has been sent.
+func (c *ServerConn) Write(b []byte) error {
+	if c.closed {
+		return errConnClosed
+	}
+	if len(b) == 0 {
+		return nil
+	}
+	b = append([]byte(nil), b...)
+	if c.sending {
+		c.pending = append(c.pending, b)
+		return nil
+	}
+	c.l.send(c, b)
+	return nil
+}
+
+// Close is used to close the connection, OnClose is called before Close
+// returns.
+func (c *ServerConn) Close() error {
+	if c.closed {
+		return errConnClosed
+	}
+	c.l.closeConn(c, nil)
+	return nil
+}
+
+// serverOpKind is the kind of request submitted by a loop.
+type serverOpKind int
+
+const (
+	serverOpAccept serverOpKind = iota
+	serverOpRecv
+	serverOpSend
+	serverOpProvide
+	serverOpCancel
+	serverOpRetry
+)
+
+// serverOp is a request submitted by a loop.
+type serverOp struct {
+	kind serverOpKind
+	c    *ServerConn
+	b    []byte
+}
+
+// serverLoop is an event loop with its own ring and buffer group.
+type serverLoop struct {
+	s   *Server
+	idx int
+	r   *Ring
+	bg  BufferGroup
+	// completions is the stream of the loop's requests, it is drained by
+	// pump so the ring never blocks on the loop.
+	completions chan CompletionEntry
+	// cqes are the completions queued for the loop by pump.
+	cqes  chan CompletionEntry
+	done  chan struct{}
+	fds   chan int
+	ops   map[uint64]*serverOp
+	conns map[int]*ServerConn
+
+	multishotAccept bool
+	multishotRecv   bool
+	acceptID        uint64
+	accepting       bool
+	stopping        bool
+	// starved are the connections that wait for a receive buffer, they are
+	// received on once a buffer is returned or after retryTs. spare is the
+	// number of buffers returned while no connection was starved.
+	starved  []*ServerConn
+	spare    int
+	retrying bool
+	retryTs  syscall.Timespec
+}
+
+func newServerLoop(s *Server, idx int) (*serverLoop, error) {
+	r, err := New(s.ringSize, nil, s.ringOpts...)
+	if err != nil {
+		return nil, err
+	}
+	bg, err := r.NewBufferGroup(s.buffers, s.bufferSize)
+	if err != nil {
+		r.Stop()
+		return nil, err
+	}
+	return &serverLoop{
+		s:               s,
+		idx:             idx,
+		r:               r,
+		bg:              bg,
+		completions:     make(chan CompletionEntry, 2*r.cq.Len()),
+		cqes:            make(chan CompletionEntry),
+		done:            make(chan struct{}),
+		fds:             make(chan int, 1024),
+		ops:             map[uint64]*serverOp{},
+		conns:           map[int]*ServerConn{},
+		multishotAccept: r.MultishotSupported(Accept),
+		multishotRecv:   r.MultishotSupported(Recv),
+	}, nil
+}
+
+func (l *serverLoop) run() error {
+	go l.pump()
+	defer close(l.done)
+	if l.idx == 0 {
+		if err := l.armAccept(); err != nil {
+			return err
+		}
+	}
+	for {
+		select {
+		case <-l.s.stop:
+			return l.shutdown()
+		case fd := <-l.fds:
+			l.open(fd)
+		case cqe := <-l.cqes:
+			if err := l.handle(cqe); err != nil {
+				l.shutdown()
+				return err
+			}
+		}
+	}
+}
+
+// shutdown is used to close all connections and wait for all requests to
+// complete.
+func (l *serverLoop) shutdown() error {
+	l.stopping = true
+	if l.accepting {
+		l.cancel(l.acceptID)
+	}
+	for _, c := range l.conns {
+		l.closeConn(c, nil)
+	}
+	for len(l.ops) > 0 {
+		select {
+		case fd := <-l.fds:
+			syscall.Close(fd)
+		case cqe := <-l.cqes:
+			l.handle(cqe)
+		}
+	}
+	return nil
+}
+
+// pump is used to queue the completions of the loop's requests until the
+// loop handles them. The loop submits requests while it handles completions,
+// so the ring must not block delivering a completion to the loop.
+func (l *serverLoop) pump() {
+	var queue []CompletionEntry
+	for {
+		var (
+			cqes chan CompletionEntry
+			next CompletionEntry
+		)
+		if len(queue) > 0 {
+			cqes = l.cqes
+			next = queue[0]
+		}
+		select {
+		case cqe := <-l.completions:
+			queue = append(queue, cqe)
+		case cqes <- next:
+			queue = queue[1:]
+		case <-l.done:
+			return
+		}
+	}
+}
+
+// track is used to deliver the completions of a request to the loop.
+func (l *serverLoop) track(id uint64, op *serverOp) {
+	l.ops[id] = op
+	l.r.streamTo(id, l.completions)
+}
+
+func (l *serverLoop) armAccept() error {
+	sqe, ready := l.r.SubmitEntry()
+	if sqe == nil {
+		return errRingUnavailable
+	}
+	sqe.Opcode = Accept
+	sqe.UserData = l.r.ID()
+	sqe.Fd = int32(l.s.fd)
+	if l.multishotAccept {
+		sqe.Ioprio = AcceptMultishot
+	}
+	ready()
+	l.acceptID = sqe.UserData
+	l.accepting = true
+	l.track(sqe.UserData, &serverOp{kind: serverOpAccept})
+	return nil
+}
+
+func (l *serverLoop) armRecv(c *ServerConn) {
+	sqe, ready := l.r.SubmitEntry()
+	if sqe == nil {
+		return
+	}
+	sqe.Opcode = Recv
+	sqe.UserData = l.r.ID()
+	sqe.Fd = int32(c.fd)
+	sqe.Flags = SqeBufferSelect
+	setBufGroup(sqe, l.bg.ID())
+	if l.multishotRecv {
+		sqe.Ioprio = RecvMultishot
+	}
+	ready()
+	c.recvArmed = true
+	l.track(sqe.UserData, &serverOp{kind: serverOpRecv, c: c})
+}
+
+func (l *serverLoop) send(c *ServerConn, b []byte) {
+	sqe, ready := l.r.SubmitEntry()
+	if sqe == nil {
+		return
+	}
+	sqe.Opcode = Send
+	sqe.UserData = l.r.ID()
+	sqe.Fd = int32(c.fd)
+	sqe.Addr = uint64(uintptr(unsafe.Pointer(&b[0])))
+	sqe.Len = uint32(len(b))
+	sqe.UFlags = int32(syscall.MSG_NOSIGNAL)
+	ready()
+	c.sending = true
+	l.track(sqe.UserData, &serverOp{kind: serverOpSend, c: c, b: b})
+}
+
+func (l *serverLoop) cancel(id uint64) {
+	cancelID, err := l.r.PrepareAsyncCancel(id, 0)
+	if err != nil {
+		return
+	}
+	l.track(cancelID, &serverOp{kind: serverOpCancel})
+}
+
+// release is used to return a receive buffer to the kernel.
+func (l *serverLoop) release(bid uint16) {
+	pb, ok := l.bg.(*providedBuffers)
+	if !ok {
+		l.bg.Release(bid)
+		l.returned()
+		return
+	}
+	// Provide the buffer asynchronously so the loop doesn't wait on the
+	// ring.
+	id, err := l.r.PrepareProvideBuffers(pb.addr(bid), pb.size, 1, pb.id, bid)
+	if err != nil {
+		return
+	}
+	l.track(id, &serverOp{kind: serverOpProvide})
+}
+
+// starve is used to wait for a receive buffer before receiving on the
+// connection, re-arming right away fails until a buffer is returned.
+func (l *serverLoop) starve(c *ServerConn) {
+	if c.starved {
+		return
+	}
+	if l.spare > 0 {
+		// A buffer was returned after the receive failed.
+		l.spare--
+		l.armRecv(c)
+		return
+	}
+	c.starved = true
+	l.starved = append(l.starved, c)
+	if l.retrying || l.stopping {
+		return
+	}
+	// A buffer may have been returned before the receive failed, so retry
+	// after a while if none is returned.
+	l.retryTs = *relativeTimespec(serverRecvRetry)
+	id, err := l.r.PrepareTimeout(&l.retryTs, 0, 0)
+	if err != nil {
+		return
+	}
+	l.retrying = true
+	l.track(id, &serverOp{kind: serverOpRetry})
+}
+
+// returned is used to receive on the connection that waited the longest for a
+// buffer once a buffer is returned.
+func (l *serverLoop) returned() {
+	if !l.refill(1) && l.spare < l.s.buffers {
+		l.spare++
+	}
+}
+
+// refill is used to receive on up to n of the connections that waited for a
+// buffer, in the order they ran out. It returns false if none waited.
+func (l *serverLoop) refill(n int) bool {
+	armed := false
+	for n > 0 && len(l.starved) > 0 {
+		c := l.starved[0]
+		l.starved[0] = nil
+		l.starved = l.starved[1:]
+		c.starved = false
+		if !c.closed && !c.recvArmed {
+			l.armRecv(c)
+			armed = true
+			n--
+		}
+	}
+	return armed
+}
+
+func (l *serverLoop) open(fd int) {
+	c := &ServerConn{
+		l:     l,
+		fd:    fd,
+		laddr: l.s.a,
+		raddr: &addr{net: l.s.a.net},
+	}
+	if sa, err := syscall.Getpeername(fd); err == nil {
+		switch sa := sa.(type) {
+		case *syscall.SockaddrInet4:
+			c.raddr.s = fmt.Sprintf("%s:%d", net.IP(sa.Addr[:]), sa.Port)
+		case *syscall.SockaddrInet6:
+			c.raddr.s = fmt.Sprintf("[%s]:%d", net.IP(sa.Addr[:]), sa.Port)
+		case *syscall.SockaddrUnix:
+			c.raddr.s = sa.Name
+		}
+	}
+	l.conns[fd] = c
+	l.s.h.OnOpen(c)
+	if !c.closed {
+		l.armRecv(c)
+	}
+}
+
+func (l *serverLoop) closeConn(c *ServerConn, err error) {
+	if c.closed {
+		return
+	}
+	c.closed = true
+	// Shutting down the socket completes the in flight requests.
+	syscall.Shutdown(c.fd, syscall.SHUT_RDWR)
+	syscall.Close(c.fd)
+	delete(l.conns, c.fd)
+	l.s.h.OnClose(c, err)
+}
+
+// handle is used to handle a completion for the loop.
+func (l *serverLoop) handle(cqe CompletionEntry) error {
+	op, ok := l.ops[cqe.UserData]
+	if !ok {
+		return nil
+	}
+	more := cqe.Flags&CqeFMore != 0
+	if !more {
+		delete(l.ops, cqe.UserData)
+	}
+
+	switch op.kind {
+	case serverOpAccept:
+		if !more {
+			l.accepting = false
+		}
+		if cqe.Res >= 0 {
+			if l.stopping {
+				syscall.Close(int(cqe.Res))
+			} else {
+				l.s.assign(l, int(cqe.Res))
+			}
+		} else if errno := syscall.Errno(-cqe.Res); errno != syscall.ECANCELED &&
+			errno != syscall.EAGAIN && errno != syscall.ECONNABORTED && errno != syscall.EINTR {
+			return errors.Wrap(errno, "failed to accept")
+		}
+		if !l.accepting && !l.stopping {
+			return l.armAccept()
+		}
+
+	case serverOpRecv:
+		c := op.c
+		if !more {
+			c.recvArmed = false
+		}
+		if bid, ok := CqeBufferID(&cqe); ok {
+			if cqe.Res > 0 && !c.closed {
+				l.s.h.OnData(c, l.bg.Buffer(bid)[:cqe.Res])
+			}
+			l.release(bid)
+		}
+		if c.closed {
+			return nil
+		}
+		if cqe.Res == 0 {
+			l.closeConn(c, nil)
+			return nil
+		}
+		if cqe.Res < 0 {
+			errno := syscall.Errno(-cqe.Res)
+			if errno == syscall.ENOBUFS {
+				if !c.recvArmed {
+					l.starve(c)
+				}
+				return nil
+			}
+			if errno != syscall.EAGAIN && errno != syscall.EINTR && errno != syscall.ECANCELED {
+				l.closeConn(c, errno)
+				return nil
+			}
+		}
+		if !c.closed && !c.recvArmed {
+			l.armRecv(c)
+		}
+
+	case serverOpSend:
+		c := op.c
+		c.sending = false
+		if c.closed {
+			return nil
+		}
+		if cqe.Res < 0 {
+			l.closeConn(c, syscall.Errno(-cqe.Res))
+			return nil
+		}
+		if int(cqe.Res) < len(op.b) {
+			// Send the rest of a short write before the pending writes.
+			l.send(c, op.b[cqe.Res:])
+			return nil
+		}
+		if len(c.pending) > 0 {
+			b := c.pending[0]
+			c.pending[0] = nil
+			c.pending = c.pending[1:]
+			l.send(c, b)
+			return nil
+		}
+		l.s.h.OnWritable(c)
+
+	case serverOpProvide:
+		l.returned()
+
+	case serverOpRetry:
+		l.retrying = false
+		l.refill(len(l.starved))
+	}
+	return nil
+}
@@ -0,0 +1,241 @@
+// +build linux
+
+package iouring
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type echoHandler struct {
+	opened   int64
+	closed   int64
+	writable int64
+	mu       sync.Mutex
+	loops    map[*serverLoop]bool
+}
+
+func (h *echoHandler) OnOpen(c *ServerConn) {
+	atomic.AddInt64(&h.opened, 1)
+	h.mu.Lock()
+	h.loops[c.l] = true
+	h.mu.Unlock()
+}
+
+func (h *echoHandler) OnData(c *ServerConn, b []byte) {
+	c.Write(b)
+}
+
+func (h *echoHandler) OnWritable(c *ServerConn) {
+	atomic.AddInt64(&h.writable, 1)
+}
+
+func (h *echoHandler) OnClose(c *ServerConn, err error) {
+	atomic.AddInt64(&h.closed, 1)
+}
+
+func TestServer(t *testing.T) {
+	h := &echoHandler{loops: map[*serverLoop]bool{}}
+	s, err := NewServer(
+		"tcp", "127.0.0.1:0", h,
+		WithLoops(2),
+		WithServerRing(256),
+		WithServerBuffers(16, 1024),
+	)
+	require.NoError(t, err)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- s.Serve()
+	}()
+
+	const clients = 4
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			conn, err := net.Dial("tcp", s.Addr().String())
+			require.NoError(t, err)
+			defer conn.Close()
+
+			msg := bytes.Repeat([]byte(fmt.Sprintf("client-%d ", i)), 500)
+			_, err = conn.Write(msg)
+			require.NoError(t, err)
+			got := make([]byte, len(msg))
+			_, err = io.ReadFull(conn, got)
+			require.NoError(t, err)
+			require.Equal(t, msg, got)
+		}(i)
+	}
+	wg.Wait()
+
+	require.NoError(t, s.Close())
+	require.NoError(t, <-serveErr)
+	require.Equal(t, int64(clients), atomic.LoadInt64(&h.opened))
+	require.Equal(t, int64(clients), atomic.LoadInt64(&h.closed))
+	require.True(t, atomic.LoadInt64(&h.writable) > 0)
+	require.Len(t, h.loops, 2)
+}
+
+func TestServerStarved(t *testing.T) {
+	var trace bytes.Buffer
+	h := &echoHandler{loops: map[*serverLoop]bool{}}
+	s, err := NewServer(
+		"tcp", "127.0.0.1:0", h,
+		WithLoops(1),
+		WithServerRing(256, WithRecorder(&trace)),
+		WithServerBuffers(1, 64),
+	)
+	require.NoError(t, err)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- s.Serve()
+	}()
+
+	const clients = 8
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			conn, err := net.Dial("tcp", s.Addr().String())
+			require.NoError(t, err)
+			defer conn.Close()
+
+			msg := bytes.Repeat([]byte(fmt.Sprintf("client-%d ", i)), 1000)
+			go conn.Write(msg)
+			got := make([]byte, len(msg))
+			_, err = io.ReadFull(conn, got)
+			require.NoError(t, err)
+			require.Equal(t, msg, got)
+		}(i)
+	}
+	wg.Wait()
+	require.NoError(t, s.Close())
+	require.NoError(t, <-serveErr)
+
+	// A connection that ran out of buffers is received on again once a
+	// buffer is returned or after a while, not right away.
+	var returned, ended, retries int
+	recvs := map[uint64]bool{}
+	tr := NewTraceReader(&trace)
+	for {
+		rec, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		switch rec.Kind {
+		case TraceSubmit:
+			switch rec.SQE.Opcode {
+			case Recv:
+				recvs[rec.SQE.UserData] = true
+			case Timeout:
+				retries++
+			}
+		case TraceComplete:
+			if _, ok := CqeBufferID(rec.CQE); ok {
+				returned++
+			}
+			if recvs[rec.CQE.UserData] && rec.CQE.Flags&CqeFMore == 0 &&
+				rec.CQE.Res != -int32(syscall.ENOBUFS) {
+				ended++
+			}
+		}
+	}
+	require.True(t, len(recvs) <= clients+returned+ended+clients*retries,
+		"%d receives for %d returned buffers", len(recvs), returned)
+}
+
+func TestServerIdle(t *testing.T) {
+	h := &echoHandler{loops: map[*serverLoop]bool{}}
+	s, err := NewServer("tcp", "127.0.0.1:0", h, WithLoops(2))
+	require.NoError(t, err)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- s.Serve()
+	}()
+	conn, err := net.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt64(&h.opened) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	require.Equal(t, int64(1), atomic.LoadInt64(&h.opened))
+
+	// The loops wait for the accept and receive without using the CPU.
+	requireIdle(t)
+
+	require.NoError(t, conn.Close())
+	require.NoError(t, s.Close())
+	require.NoError(t, <-serveErr)
+}
+
+func TestServerClose(t *testing.T) {
+	s, err := NewServer("tcp", "127.0.0.1:0", &echoHandler{loops: map[*serverLoop]bool{}}, WithLoops(1))
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+	require.Error(t, s.Serve())
+
+	_, err = NewServer("tcp", "127.0.0.1:0", nil, WithLoops(0))
+	require.Error(t, err)
+}
+
+type floodHandler struct {
+	echoHandler
+	chunks [][]byte
+}
+
+func (h *floodHandler) OnOpen(c *ServerConn) {
+	h.echoHandler.OnOpen(c)
+	for _, b := range h.chunks {
+		c.Write(b)
+	}
+}
+
+func TestServerWriteOrder(t *testing.T) {
+	h := &floodHandler{echoHandler: echoHandler{loops: map[*serverLoop]bool{}}}
+	var want []byte
+	for i := 0; i < 64; i++ {
+		b := bytes.Repeat([]byte{byte(i)}, 64*1024)
+		h.chunks = append(h.chunks, b)
+		want = append(want, b...)
+	}
+	s, err := NewServer("tcp", "127.0.0.1:0", h, WithLoops(1), WithServerRing(8))
+	require.NoError(t, err)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- s.Serve()
+	}()
+
+	conn, err := net.Dial("tcp", s.Addr().String())
+	require.NoError(t, err)
+	got := make([]byte, len(want))
+	_, err = io.ReadFull(conn, got)
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(want, got))
+	// The data can be read before the loop handles the completion of the
+	// last send.
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt64(&h.writable) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	require.NoError(t, conn.Close())
+
+	require.NoError(t, s.Close())
+	require.NoError(t, <-serveErr)
+	require.Equal(t, int64(1), atomic.LoadInt64(&h.writable))
+}
@@ -0,0 +1,103 @@
+// +build linux
+
+package iouring
+
+import "github.com/pkg/errors"
+
+const (
+	// newSetupFlags are the setup flags that older kernels reject.
+	newSetupFlags = SetupSubmitAll | SetupCoopTaskrun | SetupTaskrunFlag |
+		SetupSQE128 | SetupCQE32 | SetupSingleIssuer | SetupDeferTaskrun
+)
+
+// setupFlagDeps are the flags that a setup flag can't be used without.
+var setupFlagDeps = map[uint32]uint32{
+	SetupDeferTaskrun: SetupSingleIssuer,
+	SetupTaskrunFlag:  SetupCoopTaskrun,
+}
+
+// unsupportedSetupFlags returns the new setup flags that the kernel rejects,
+// each flag is checked with the flags it depends on.
+func unsupportedSetupFlags(flags uint32) uint32 {
+	var unsupported uint32
+	for f := uint32(1); f != 0 && f <= flags; f <<= 1 {
+		if flags&newSetupFlags&f != 0 && !setupSupported(f|setupFlagDeps[f]) {
+			unsupported |= f
+		}
+	}
+	return unsupported
+}
+
+// setupOption returns a RingOption that adds setup flags to the Params of a
+// ring that hasn't been setup, rings that were imported must have been setup
+// with the flags.
+func setupOption(flags uint32) RingOption {
+	return func(r *Ring) error {
+		if r.fd < 0 {
+			r.p.Flags |= flags
+			return nil
+		}
+		return requireSetupFlags(r, flags)
+	}
+}
+
+// requireSetupFlags is used to check that a ring was setup with flags, rings
+// that were imported may not have been.
+func requireSetupFlags(r *Ring, flags uint32) error {
+	if r.p.Flags&flags != flags {
+		return errors.Errorf("ring not setup with flags %#x", flags)
+	}
+	return nil
+}
+
+// WithSingleIssuer is used to setup the ring with SetupSingleIssuer, the
+// kernel only allows one thread to submit requests. The ring is entered by a
+// locked worker, see WithLockedThread, and is enabled from the worker thread.
+// The ring's register calls are made by the worker, io_uring_register calls
+// made on the ring fd from other threads fail with EEXIST after New returns.
+func WithSingleIssuer() RingOption {
+	return setupOption(SetupSingleIssuer)
+}
+
+// WithDeferTaskrun is used to setup the ring with SetupDeferTaskrun, which
+// implies WithSingleIssuer. Completions are only posted when the ring is
+// entered with EnterGetEvents so every enter of the ring gets events and the
+// worker periodically enters the ring when it is idle.
+func WithDeferTaskrun() RingOption {
+	return setupOption(SetupSingleIssuer | SetupDeferTaskrun)
+}
+
+// WithCoopTaskrun is used to setup the ring with SetupCoopTaskrun and
+// SetupTaskrunFlag, the kernel doesn't interrupt the submitting thread to
+// post completions and the ring is entered when SqTaskrun is set.
+func WithCoopTaskrun() RingOption {
+	return setupOption(SetupCoopTaskrun | SetupTaskrunFlag)
+}
+
+// WithSubmitAll is used to setup the ring with SetupSubmitAll, submitting
+// continues when a request fails to submit.
+func WithSubmitAll() RingOption {
+	return setupOption(SetupSubmitAll)
+}
+
+// WithSQE128 is used to setup the ring with SetupSQE128, each SubmitEntry
+// has 64 extra bytes of command data, see SubmitQueue.Cmd.
+func WithSQE128() RingOption {
+	return setupOption(SetupSQE128)
+}
+
+// WithCQE32 is used to setup the ring with SetupCQE32, each CompletionEntry
+// has 16 extra bytes, see CompletionQueue.Big, Ring.WaitBig and
+// Ring.StreamBig.
+func WithCQE32() RingOption {
+	return setupOption(SetupCQE32)
+}
+
+// issue is used to call fn on the thread that is allowed to issue requests
+// to the ring.
+func (r *Ring) issue(fn func() error) error {
+	if r.worker != nil {
+		return r.worker.do(fn)
+	}
+	return fn()
+}
@@ -0,0 +1,194 @@
+// +build linux
+
+package iouring
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func newSetupRing(t *testing.T, opts ...RingOption) *Ring {
+	r, err := New(2048, nil, opts...)
+	if errors.Cause(err) == ErrNotSupported {
+		t.Skip(err)
+	}
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	return r
+}
+
+func TestWithSingleIssuer(t *testing.T) {
+	r := newSetupRing(t, WithSingleIssuer())
+	defer r.Stop()
+	require.NotNil(t, r.worker)
+	require.NotZero(t, r.p.Flags&SetupSingleIssuer)
+	require.Zero(t, r.p.Flags&SetupRDisabled)
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, r.Nop())
+	}
+
+	// Other threads can't enter the ring.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	_, err := Enter(r.Fd(), 1, 0, 0, nil)
+	require.Equal(t, syscall.EEXIST, err)
+}
+
+func TestWithSingleIssuerRegister(t *testing.T) {
+	r := newSetupRing(t, WithSingleIssuer(), WithFileRegistry())
+	defer r.Stop()
+
+	// Register calls are made by the worker thread.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	reg := r.FileRegistry()
+	require.NoError(t, reg.Register(int(os.Stdout.Fd())))
+	require.NoError(t, reg.Unregister(int(os.Stdout.Fd())))
+
+	br, err := r.NewBufferRegistry(1)
+	require.NoError(t, err)
+	_, err = br.Update(0, make([]byte, 64))
+	require.NoError(t, err)
+
+	p, err := r.RegisterPersonality()
+	require.NoError(t, err)
+	require.NoError(t, r.UnregisterPersonality(p))
+}
+
+func TestWithDeferTaskrun(t *testing.T) {
+	r := newSetupRing(t, WithDeferTaskrun())
+	defer r.Stop()
+	require.NotZero(t, r.p.Flags&SetupSingleIssuer)
+
+	var p [2]int
+	require.NoError(t, unix.Pipe(p[:]))
+	defer unix.Close(p[0])
+	defer unix.Close(p[1])
+
+	done := make(chan error, 1)
+	b := make([]byte, 4)
+	go func() {
+		id, err := r.PrepareRead(p[0], b, 0, 0)
+		if err == nil {
+			_, err = r.wait(id)
+		}
+		done <- err
+	}()
+	_, err := unix.Write(p[1], []byte("test"))
+	require.NoError(t, err)
+	require.NoError(t, <-done)
+	require.Equal(t, "test", string(b))
+}
+
+func TestWithCoopTaskrunSubmitAll(t *testing.T) {
+	r := newSetupRing(t, WithCoopTaskrun(), WithSubmitAll())
+	defer r.Stop()
+	require.NotZero(t, r.p.Flags&SetupCoopTaskrun)
+	require.NotZero(t, r.p.Flags&SetupSubmitAll)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, r.Nop())
+	}
+}
+
+func TestSetupFlagsInvalid(t *testing.T) {
+	// SetupTaskrunFlag is supported but requires SetupCoopTaskrun.
+	if unsupportedSetupFlags(SetupTaskrunFlag) != 0 {
+		t.Skip("taskrun flag not supported")
+	}
+	_, err := New(8, &Params{Flags: SetupTaskrunFlag})
+	require.Equal(t, syscall.EINVAL, err)
+}
+
+func TestSetupOptionWrapped(t *testing.T) {
+	// Setup options may be called by other options.
+	sqe128 := func(r *Ring) error {
+		return WithSQE128()(r)
+	}
+	r := newSetupRing(t, sqe128, WithLockedThread())
+	defer r.Stop()
+	require.NotZero(t, r.p.Flags&SetupSQE128)
+	require.Len(t, r.sq.Entries, int(2*r.sq.Len()))
+	require.NoError(t, r.Nop())
+}
+
+func TestSetupOptionRequiresFlags(t *testing.T) {
+	r, err := New(8, nil)
+	require.NoError(t, err)
+	defer r.Stop()
+	require.Error(t, WithSingleIssuer()(r))
+}
+
+func TestWithSQE128(t *testing.T) {
+	r, err := New(8, nil, WithSQE128())
+	if errors.Cause(err) == ErrNotSupported {
+		t.Skip(err)
+	}
+	require.NoError(t, err)
+	defer r.Stop()
+	require.Equal(t, uint32(8), r.sq.Len())
+	require.Len(t, r.sq.Entries, 16)
+
+	// Wrap around the ring a few times.
+	for i := 0; i < 50; i++ {
+		require.NoError(t, r.Nop())
+	}
+
+	sqe, ready := r.SubmitEntry()
+	require.NotNil(t, sqe)
+	cmd := r.sq.Cmd(sqe)
+	require.Len(t, cmd, 80)
+	for i := range cmd {
+		cmd[i] = 0xff
+	}
+	// The command data doesn't overlap the next entry.
+	for i := uint32(0); i < r.sq.Len(); i++ {
+		if e := r.sq.Entry(i); e != sqe {
+			require.NotEqual(t, Opcode(0xff), e.Opcode)
+		}
+	}
+	sqe.Opcode = Nop
+	sqe.UserData = r.ID()
+	ready()
+	cqe := r.WaitBig(sqe.UserData)
+	require.Equal(t, int32(0), cqe.Res)
+
+	// The command data is cleared when an entry is reused.
+	for i := uint32(0); i < r.sq.Len(); i++ {
+		sqe, ready := r.SubmitEntry()
+		require.NotNil(t, sqe)
+		require.Equal(t, make([]byte, 80), r.sq.Cmd(sqe))
+		sqe.UserData = r.ID()
+		ready()
+		cqe := r.WaitBig(sqe.UserData)
+		require.Equal(t, int32(0), cqe.Res)
+	}
+}
+
+func TestWithCQE32(t *testing.T) {
+	r, err := New(8, nil, WithCQE32())
+	if errors.Cause(err) == ErrNotSupported {
+		t.Skip(err)
+	}
+	require.NoError(t, err)
+	defer r.Stop()
+	require.Equal(t, r.p.CqEntries, r.cq.Len())
+	require.Len(t, r.cq.Entries, int(2*r.p.CqEntries))
+	require.NotNil(t, r.cq.Big(r.cq.Entry(0)))
+
+	for i := 0; i < 50; i++ {
+		require.NoError(t, r.Nop())
+	}
+	id, err := r.PrepareNop()
+	require.NoError(t, err)
+	cqe := r.WaitBig(id)
+	require.Equal(t, id, cqe.UserData)
+	require.Equal(t, int32(0), cqe.Res)
+	require.Equal(t, [2]uint64{}, cqe.Big)
+}
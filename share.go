@@ -0,0 +1,58 @@
+// +build linux
+
+package iouring
+
+import (
+	"os"
+	"sync/atomic"
+
+	"golang.org/x/sys/unix"
+)
+
+// Export is used to hand the ring to another process, the file and Params are
+// passed to Import. Registered files, buffers and personalities are shared
+// with the importer. The file can be inherited by a child process (see
+// exec.Cmd.ExtraFiles) or fetched with pidfd_getfd(2), kernels since 6.7
+// refuse to send io_uring files over unix sockets with SCM_RIGHTS.
+//
+// The submit and completion queues can only have a single user, so after
+// Export the Ring stops submitting and reaping completions and all further
+// requests fail. Export should be called when there are no requests in
+// flight. A nil file is returned if the ring fd can't be duplicated. Stop must
+// still be called to release the ring's memory.
+func (r *Ring) Export() (*os.File, Params) {
+	fd, err := unix.FcntlInt(uintptr(r.fd), unix.F_DUPFD_CLOEXEC, 0)
+	if err != nil {
+		return nil, *r.p
+	}
+	if atomic.CompareAndSwapInt32(&r.exported, 0, 1) {
+		if r.submitter != nil {
+			r.submitter.stop()
+		}
+		if r.worker != nil {
+			r.worker.stop()
+		}
+		r.stopRun()
+	}
+	return os.NewFile(uintptr(fd), "io_uring"), *r.p
+}
+
+// Import is used to create a Ring from a ring file that was exported by
+// another Ring, p must be the Params returned by Export. The file is
+// duplicated so it may be closed after Import returns. Only one Ring may use
+// an exported ring at a time.
+func Import(f *os.File, p Params, opts ...RingOption) (*Ring, error) {
+	fd, err := unix.FcntlInt(f.Fd(), unix.F_DUPFD_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		cq CompletionQueue
+		sq SubmitQueue
+	)
+	if err := MmapRing(fd, &p, &sq, &cq); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+	return newRing(fd, &p, &sq, &cq, opts)
+}
@@ -0,0 +1,82 @@
+// +build linux
+
+package iouring
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+const importHelperEnv = "IOURING_IMPORT_PARAMS"
+
+func TestRingExportImport(t *testing.T) {
+	r, err := New(2048, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	defer r.Stop()
+	require.NoError(t, r.Nop())
+
+	// Register a file with the supervisor ring.
+	var p [2]int
+	require.NoError(t, unix.Pipe(p[:]))
+	defer unix.Close(p[0])
+	defer unix.Close(p[1])
+	require.NoError(t, RegisterFiles(r.Fd(), []int{p[1]}))
+
+	f, params := r.Export()
+	require.NotNil(t, f)
+	defer f.Close()
+	require.Equal(t, errRingUnavailable, r.Nop())
+
+	var buf bytes.Buffer
+	require.NoError(t, binary.Write(&buf, binary.LittleEndian, &params))
+	cmd := exec.Command(os.Args[0], "-test.run=TestRingImportHelper")
+	cmd.Env = append(os.Environ(), importHelperEnv+"="+hex.EncodeToString(buf.Bytes()))
+	cmd.ExtraFiles = []*os.File{f}
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+
+	// The worker wrote to the file registered by the supervisor.
+	if r.Supported(FixedFdInstall) {
+		b := make([]byte, 4)
+		_, err = unix.Read(p[0], b)
+		require.NoError(t, err)
+		require.Equal(t, "test", string(b))
+	}
+}
+
+// TestRingImportHelper is run in a child process by TestRingExportImport.
+func TestRingImportHelper(t *testing.T) {
+	encoded := os.Getenv(importHelperEnv)
+	if encoded == "" {
+		t.Skip("only run as a helper process")
+	}
+	b, err := hex.DecodeString(encoded)
+	require.NoError(t, err)
+	var params Params
+	require.NoError(t, binary.Read(bytes.NewReader(b), binary.LittleEndian, &params))
+
+	f := os.NewFile(3, "io_uring")
+	r, err := Import(f, params)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	defer r.Stop()
+
+	for i := 0; i < 4096; i++ {
+		require.NoError(t, r.Nop())
+	}
+	if r.Supported(FixedFdInstall) {
+		fd, err := r.FixedFdInstall(0, 0)
+		require.NoError(t, err)
+		_, err = unix.Write(fd, []byte("test"))
+		require.NoError(t, err)
+		unix.Close(fd)
+	}
+}
@@ -0,0 +1,178 @@
+// +build linux
+
+package iouring
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// statxMntID is the statx mask for the mount id.
+	statxMntID = 0x1000
+
+	// statMask is the statx mask used for Stat and Lstat.
+	statMask = unix.STATX_BASIC_STATS | unix.STATX_BTIME | statxMntID
+)
+
+// StatxInfo is returned by the Sys method of a os.FileInfo returned from
+// Stat, Lstat or StatMany.
+type StatxInfo struct {
+	Statx unix.Statx_t
+}
+
+// BirthTime returns the creation time of the file, if the filesystem doesn't
+// support birth times false is returned.
+func (s *StatxInfo) BirthTime() (time.Time, bool) {
+	if s.Statx.Mask&unix.STATX_BTIME == 0 {
+		return time.Time{}, false
+	}
+	return statxTime(s.Statx.Btime), true
+}
+
+// MountID returns the id of the mount containing the file, if the kernel
+// doesn't report mount ids false is returned.
+func (s *StatxInfo) MountID() (uint64, bool) {
+	if s.Statx.Mask&statxMntID == 0 {
+		return 0, false
+	}
+	// stx_mnt_id is the first field after stx_dev_minor, which is spare
+	// space in unix.Statx_t.
+	return *(*uint64)(unsafe.Pointer(uintptr(unsafe.Pointer(&s.Statx.Dev_minor)) + 4)), true
+}
+
+func statxTime(ts unix.StatxTimestamp) time.Time {
+	return time.Unix(ts.Sec, int64(ts.Nsec))
+}
+
+// fileStat implements the os.FileInfo interface.
+type fileStat struct {
+	name string
+	sys  StatxInfo
+}
+
+// Name implements the os.FileInfo interface.
+func (fs *fileStat) Name() string {
+	return fs.name
+}
+
+// Size implements the os.FileInfo interface.
+func (fs *fileStat) Size() int64 {
+	return int64(fs.sys.Statx.Size)
+}
+
+// Mode implements the os.FileInfo interface.
+func (fs *fileStat) Mode() os.FileMode {
+	m := uint32(fs.sys.Statx.Mode)
+	mode := os.FileMode(m & 0777)
+	switch m & syscall.S_IFMT {
+	case syscall.S_IFBLK:
+		mode |= os.ModeDevice
+	case syscall.S_IFCHR:
+		mode |= os.ModeDevice | os.ModeCharDevice
+	case syscall.S_IFDIR:
+		mode |= os.ModeDir
+	case syscall.S_IFIFO:
+		mode |= os.ModeNamedPipe
+	case syscall.S_IFLNK:
+		mode |= os.ModeSymlink
+	case syscall.S_IFSOCK:
+		mode |= os.ModeSocket
+	}
+	if m&syscall.S_ISGID != 0 {
+		mode |= os.ModeSetgid
+	}
+	if m&syscall.S_ISUID != 0 {
+		mode |= os.ModeSetuid
+	}
+	if m&syscall.S_ISVTX != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode
+}
+
+// ModTime implements the os.FileInfo interface.
+func (fs *fileStat) ModTime() time.Time {
+	return statxTime(fs.sys.Statx.Mtime)
+}
+
+// IsDir implements the os.FileInfo interface.
+func (fs *fileStat) IsDir() bool {
+	return fs.Mode().IsDir()
+}
+
+// Sys implements the os.FileInfo interface, it returns a *StatxInfo.
+func (fs *fileStat) Sys() interface{} {
+	return &fs.sys
+}
+
+// Stat returns a os.FileInfo for the file at the path.
+func (r *Ring) Stat(path string) (os.FileInfo, error) {
+	return r.stat(path, 0)
+}
+
+// Lstat returns a os.FileInfo for the file at the path, if the file is a
+// symbolic link the link is described.
+func (r *Ring) Lstat(path string) (os.FileInfo, error) {
+	return r.stat(path, unix.AT_SYMLINK_NOFOLLOW)
+}
+
+func (r *Ring) stat(path string, flags int) (os.FileInfo, error) {
+	fs := &fileStat{name: filepath.Base(path)}
+	err := r.Statx(unix.AT_FDCWD, path, flags, statMask, &fs.sys.Statx)
+	if err != nil {
+		return nil, &os.PathError{Op: "statx", Path: path, Err: err}
+	}
+	return fs, nil
+}
+
+// StatMany is used to stat multiple paths, the requests are submitted to the
+// ring with a single enter (or one enter per submit queue worth of paths).
+// The errors are in the same order as the paths and are nil on success.
+func (r *Ring) StatMany(paths []string) ([]os.FileInfo, []error) {
+	infos := make([]os.FileInfo, len(paths))
+	errs := make([]error, len(paths))
+	stats := make([]fileStat, len(paths))
+	ids := make([]uint64, len(paths))
+
+	batch := int(r.sq.Len())
+	for start := 0; start < len(paths); start += batch {
+		end := start + batch
+		if end > len(paths) {
+			end = len(paths)
+		}
+		// Prepare all the entries before waiting so they are
+		// submitted together.
+		for i := start; i < end; i++ {
+			stats[i].name = filepath.Base(paths[i])
+			id, err := r.PrepareStatx(
+				unix.AT_FDCWD, paths[i], 0, statMask, &stats[i].sys.Statx)
+			if err != nil {
+				errs[i] = &os.PathError{Op: "statx", Path: paths[i], Err: err}
+				continue
+			}
+			ids[i] = id
+		}
+		for i := start; i < end; i++ {
+			if errs[i] != nil {
+				continue
+			}
+			res, _ := r.complete(ids[i])
+			if res < 0 {
+				errs[i] = &os.PathError{
+					Op:   "statx",
+					Path: paths[i],
+					Err:  syscall.Errno(-res),
+				}
+				continue
+			}
+			infos[i] = &stats[i]
+		}
+	}
+	return infos, errs
+}
@@ -0,0 +1,99 @@
+// +build linux
+
+package iouring
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRingStat(t *testing.T) {
+	r, err := New(2048, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+
+	dir, err := ioutil.TempDir("", "stat")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "file")
+	require.NoError(t, ioutil.WriteFile(path, []byte("test"), 0640))
+	link := filepath.Join(dir, "link")
+	require.NoError(t, os.Symlink(path, link))
+
+	fi, err := r.Stat(path)
+	require.NoError(t, err)
+	expected, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, expected.Name(), fi.Name())
+	require.Equal(t, expected.Size(), fi.Size())
+	require.Equal(t, expected.Mode(), fi.Mode())
+	require.True(t, expected.ModTime().Equal(fi.ModTime()))
+	require.False(t, fi.IsDir())
+
+	info, ok := fi.Sys().(*StatxInfo)
+	require.True(t, ok)
+	if btime, ok := info.BirthTime(); ok {
+		require.False(t, btime.IsZero())
+	}
+	if id, ok := info.MountID(); ok {
+		require.NotZero(t, id)
+	}
+
+	fi, err = r.Stat(link)
+	require.NoError(t, err)
+	require.True(t, fi.Mode().IsRegular())
+	fi, err = r.Lstat(link)
+	require.NoError(t, err)
+	require.Equal(t, os.ModeSymlink, fi.Mode()&os.ModeSymlink)
+
+	fi, err = r.Stat(dir)
+	require.NoError(t, err)
+	require.True(t, fi.IsDir())
+
+	_, err = r.Stat(filepath.Join(dir, "missing"))
+	require.True(t, os.IsNotExist(err))
+
+	// The path must be NUL terminated even when it is a substring of a
+	// longer string.
+	longer := path + "x"
+	fi, err = r.Stat(longer[:len(path)])
+	require.NoError(t, err)
+	require.Equal(t, "file", fi.Name())
+}
+
+func TestRingStatMany(t *testing.T) {
+	r, err := New(8, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+
+	dir, err := ioutil.TempDir("", "stat")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var paths []string
+	for i := 0; i < 20; i++ {
+		path := filepath.Join(dir, string(rune('a'+i)))
+		require.NoError(t, ioutil.WriteFile(path, make([]byte, i), 0644))
+		paths = append(paths, path)
+	}
+	paths = append(paths, filepath.Join(dir, "missing"))
+
+	infos, errs := r.StatMany(paths)
+	require.Len(t, infos, len(paths))
+	require.Len(t, errs, len(paths))
+	for i := 0; i < 20; i++ {
+		require.NoError(t, errs[i])
+		require.Equal(t, int64(i), infos[i].Size())
+		require.Equal(t, filepath.Base(paths[i]), infos[i].Name())
+	}
+	require.Nil(t, infos[20])
+	pathErr, ok := errs[20].(*os.PathError)
+	require.True(t, ok)
+	require.Equal(t, syscall.ENOENT, pathErr.Err)
+}
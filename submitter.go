@@ -2,26 +2,82 @@
 
 package iouring
 
-import "time"
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// defaultBatchSize is the batch size used by the WithDeadline option.
+	defaultBatchSize = 32
+)
 
 type submitter interface {
 	submit(uint64)
 	stop()
+	stats() SubmitStats
 }
 
+// SubmitStats are statistics for batched submissions.
+type SubmitStats struct {
+	// Batches is the number of times the ring was entered to submit.
+	Batches uint64
+	// Entries is the number of entries that have been submitted.
+	Entries uint64
+	// MaxBatch is the size of the largest submitted batch.
+	MaxBatch uint64
+	// LastBatch is the size of the most recently submitted batch.
+	LastBatch uint64
+	// Deadline is the current deadline for flushing a batch.
+	Deadline time.Duration
+}
+
+// MeanBatch returns the average batch size.
+func (s SubmitStats) MeanBatch() float64 {
+	if s.Batches == 0 {
+		return 0
+	}
+	return float64(s.Entries) / float64(s.Batches)
+}
+
+// ringSubmitter batches submissions and enters the ring when either the batch
+// size is reached or the deadline expires. The deadline is adapted to the
+// arrival rate of submissions, when submissions are sparse enough that a
+// batch would not fill before the maximum deadline they are flushed
+// immediately.
 type ringSubmitter struct {
-	r        *Ring
-	done     chan struct{}
-	work     chan struct{}
-	deadline time.Duration
+	r           *Ring
+	done        chan struct{}
+	work        chan struct{}
+	batchSize   int
+	maxDeadline time.Duration
+	// enter is used to enter the ring, it is replaced by tests.
+	enter func(toSubmit uint, minComplete uint, flags uint, sigset *unix.Sigset_t) (int, error)
+
+	// gap is the moving average of the time between submissions.
+	gap  time.Duration
+	last time.Time
+
+	mu sync.Mutex
+	st SubmitStats
 }
 
-func newRingSubmitter(r *Ring, deadline time.Duration) *ringSubmitter {
+func newRingSubmitter(r *Ring, batchSize int, maxDeadline time.Duration) *ringSubmitter {
+	if batchSize < 1 {
+		batchSize = 1
+	}
 	return &ringSubmitter{
-		r:        r,
-		done:     make(chan struct{}),
-		work:     make(chan struct{}, 128),
-		deadline: deadline,
+		r:           r,
+		enter:       r.Enter,
+		done:        make(chan struct{}),
+		work:        make(chan struct{}, 128),
+		batchSize:   batchSize,
+		maxDeadline: maxDeadline,
+		// Assume the ring is idle until submissions arrive.
+		gap: maxDeadline,
+		st:  SubmitStats{Deadline: maxDeadline},
 	}
 }
 
@@ -30,39 +86,106 @@ func (s *ringSubmitter) submit(reqID uint64) {
 	s.work <- struct{}{}
 }
 
+// observe updates the average time between submissions.
+func (s *ringSubmitter) observe(now time.Time) {
+	if !s.last.IsZero() {
+		// Exponentially weighted moving average with alpha 1/8.
+		s.gap += (now.Sub(s.last) - s.gap) / 8
+	}
+	s.last = now
+}
+
+// deadline returns the time to wait for a batch to fill, a zero deadline
+// means the batch should be flushed immediately because it isn't expected to
+// fill before the maximum deadline.
+func (s *ringSubmitter) deadline(count int) time.Duration {
+	d := s.gap * time.Duration(s.batchSize-count)
+	if d > s.maxDeadline {
+		d = 0
+	}
+	s.mu.Lock()
+	s.st.Deadline = d
+	s.mu.Unlock()
+	return d
+}
+
+// flush enters the ring to submit a batch, it returns the number of entries
+// that weren't submitted.
+func (s *ringSubmitter) flush(count int) int {
+	n, err := s.enter(uint(count), 0, 0, nil)
+	if err != nil {
+		// The SQEs remain in the ring and are submitted when the batch
+		// is retried.
+		if s.r.enterErrHandler != nil {
+			s.r.enterErrHandler(err)
+		}
+	}
+	if n > 0 {
+		s.mu.Lock()
+		s.st.Batches++
+		s.st.Entries += uint64(n)
+		s.st.LastBatch = uint64(n)
+		if uint64(n) > s.st.MaxBatch {
+			s.st.MaxBatch = uint64(n)
+		}
+		s.mu.Unlock()
+	}
+	left := count - n
+	// The ring may have been entered to submit, such as when the submit
+	// queue is full.
+	if pending := int(s.r.sqPending()); left > pending {
+		left = pending
+	}
+	if left < 0 {
+		left = 0
+	}
+	return left
+}
+
 func (s *ringSubmitter) run() {
-	timer := time.NewTimer(s.deadline)
+	timer := time.NewTimer(s.maxDeadline)
 	if !timer.Stop() {
 		<-timer.C
 	}
 	count := 0
-	seen := 0
 	timerActive := false
 	for {
 		select {
 		case <-timer.C:
-		enter:
-			n, err := s.r.Enter(uint(count), uint(0), EnterGetEvents, nil)
-			if err != nil {
-				continue
+			timerActive = false
+			if count > 0 {
+				count = s.flush(count)
 			}
-			seen += n
-			if seen < count {
-				goto enter
+			if count > 0 {
+				// Retry the rest of the batch on the next
+				// deadline.
+				timerActive = true
+				timer.Reset(s.maxDeadline)
 			}
-			seen = 0
-			count = 0
-			timerActive = false
 
 		case <-s.work:
+			s.observe(time.Now())
+			count++
+			d := s.deadline(count)
+			if count >= s.batchSize || d == 0 {
+				if timerActive && !timer.Stop() {
+					<-timer.C
+				}
+				timerActive = false
+				count = s.flush(count)
+				if count > 0 {
+					timerActive = true
+					timer.Reset(s.maxDeadline)
+				}
+				continue
+			}
 			if !timerActive {
 				timerActive = true
-				timer.Reset(s.deadline)
+				timer.Reset(d)
 			}
-			count++
 
 		case <-s.done:
-			if !timer.Stop() {
+			if timerActive && !timer.Stop() {
 				<-timer.C
 			}
 			return
@@ -73,3 +196,9 @@ func (s *ringSubmitter) run() {
 func (s *ringSubmitter) stop() {
 	s.done <- struct{}{}
 }
+
+func (s *ringSubmitter) stats() SubmitStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.st
+}
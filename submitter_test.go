@@ -0,0 +1,130 @@
+// +build linux
+
+package iouring
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestRingSubmitterDeadline(t *testing.T) {
+	s := newRingSubmitter(nil, 8, time.Millisecond)
+	// An idle ring flushes immediately.
+	require.Zero(t, s.deadline(1))
+
+	s.gap = 10 * time.Microsecond
+	require.Equal(t, 70*time.Microsecond, s.deadline(1))
+
+	// Batches that won't fill before the deadline are flushed.
+	s.gap = 500 * time.Microsecond
+	require.Zero(t, s.deadline(1))
+}
+
+func TestRingSubmitterObserve(t *testing.T) {
+	s := newRingSubmitter(nil, 8, time.Millisecond)
+	now := time.Now()
+	s.observe(now)
+	require.Equal(t, time.Millisecond, s.gap)
+	for i := 1; i <= 100; i++ {
+		s.observe(now.Add(time.Duration(i) * time.Microsecond))
+	}
+	require.True(t, s.gap < 10*time.Microsecond, "gap %v", s.gap)
+}
+
+func TestWithBatching(t *testing.T) {
+	r, err := New(1024, nil, WithBatching(8, time.Millisecond))
+	require.NoError(t, err)
+	require.NotNil(t, r)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 8; j++ {
+				require.NoError(t, r.Nop())
+			}
+		}()
+	}
+	wg.Wait()
+
+	stats := r.SubmitStats()
+	require.NotZero(t, stats.Batches)
+	require.True(t, stats.MaxBatch <= 8)
+	require.True(t, stats.MeanBatch() >= 1)
+	require.NoError(t, r.Stop())
+}
+
+func TestRingSubmitterEnterError(t *testing.T) {
+	errs := make(chan error, 1)
+	r, err := New(1024, nil, WithEnterErrHandler(func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	}))
+	require.NoError(t, err)
+	defer r.Stop()
+
+	// Fail the first enter, the entry must be submitted when the batch is
+	// retried.
+	s := newRingSubmitter(r, 8, time.Millisecond)
+	var enters int32
+	s.enter = func(toSubmit uint, minComplete uint, flags uint, sigset *unix.Sigset_t) (int, error) {
+		if atomic.AddInt32(&enters, 1) == 1 {
+			return 0, syscall.EAGAIN
+		}
+		return r.Enter(toSubmit, minComplete, flags, sigset)
+	}
+	go s.run()
+	defer s.stop()
+
+	sqe := r.nextEntry()
+	require.NotNil(t, sqe)
+	sqe.Opcode = Nop
+	sqe.UserData = r.ID()
+	r.sq.completeWrite()
+	s.submit(sqe.UserData)
+
+	deadline := time.Now().Add(time.Second)
+	for r.sqPending() > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	require.Zero(t, r.sqPending())
+	require.Equal(t, syscall.EAGAIN, <-errs)
+	require.Equal(t, int32(2), atomic.LoadInt32(&enters))
+	require.Equal(t, uint64(1), s.stats().Entries)
+}
+
+func TestWithBatchingReadWriter(t *testing.T) {
+	r, err := New(1024, nil, WithBatching(8, time.Millisecond))
+	require.NoError(t, err)
+	require.NotNil(t, r)
+
+	f, err := ioutil.TempFile("", "batching")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	rw, err := r.FileReadWriter(f)
+	require.NoError(t, err)
+	content := []byte("testing...1,2.3")
+	n, err := rw.Write(content)
+	require.NoError(t, err)
+	require.Equal(t, len(content), n)
+
+	buf := make([]byte, len(content))
+	n, err = rw.ReadAt(buf, 0)
+	require.NoError(t, err)
+	require.Equal(t, len(content), n)
+	require.Equal(t, content, buf)
+	require.NoError(t, r.Stop())
+}
@@ -0,0 +1,270 @@
+// +build linux
+
+package iouring
+
+import (
+	"context"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	/*
+	 * sqe->timeout_flags
+	 */
+
+	// TimeoutAbs is used for an absolute CLOCK_MONOTONIC timespec.
+	TimeoutAbs = (1 << 0)
+	// TimeoutUpdate is used to update an existing timeout.
+	TimeoutUpdate = (1 << 1)
+	// TimeoutBoottime is used to use CLOCK_BOOTTIME.
+	TimeoutBoottime = (1 << 2)
+	// TimeoutRealtime is used to use CLOCK_REALTIME.
+	TimeoutRealtime = (1 << 3)
+)
+
+// TimerOption is used to configure a Timer.
+type TimerOption func(*Timer)
+
+// WithTimerCount is used to fire the timer after count other completions
+// even if the duration hasn't elapsed.
+func WithTimerCount(count int) TimerOption {
+	return func(t *Timer) {
+		t.count = count
+	}
+}
+
+// Timer is a timer that is backed by a timeout request on the ring, so that
+// timers and IO complete through the same queue.
+type Timer struct {
+	// C receives the time the timer fired, it is nil for timers created
+	// with AfterFunc.
+	C <-chan time.Time
+	c chan time.Time
+	f func()
+
+	r     *Ring
+	count int
+
+	mu     sync.Mutex
+	id     uint64
+	active bool
+}
+
+// timerQueue dispatches timeout completions to timers.
+type timerQueue struct {
+	c  chan CompletionEntry
+	mu sync.Mutex
+	// armed are the in flight timeouts, the timespec must stay alive
+	// until the timeout has been submitted.
+	armed map[uint64]armedTimer
+}
+
+type armedTimer struct {
+	t  *Timer
+	ts *syscall.Timespec
+}
+
+// timerQueue returns the timerQueue of the ring, it is started on first use.
+func (r *Ring) timerQueue() *timerQueue {
+	r.timersOnce.Do(func() {
+		r.timers = &timerQueue{
+			c:     make(chan CompletionEntry, r.cq.Len()),
+			armed: map[uint64]armedTimer{},
+		}
+		go r.timers.run()
+	})
+	return r.timers
+}
+
+func (q *timerQueue) run() {
+	for cqe := range q.c {
+		q.mu.Lock()
+		a, ok := q.armed[cqe.UserData]
+		delete(q.armed, cqe.UserData)
+		q.mu.Unlock()
+		if ok {
+			a.t.expired(cqe)
+		}
+	}
+}
+
+// NewTimer returns a Timer that sends the current time on its channel after
+// the duration.
+func (r *Ring) NewTimer(d time.Duration, opts ...TimerOption) (*Timer, error) {
+	t := r.newTimer(nil, opts)
+	if err := t.arm(relativeTimespec(d), 0); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// NewTimerAt returns a Timer that sends the current time on its channel at
+// the given time.
+func (r *Ring) NewTimerAt(at time.Time, opts ...TimerOption) (*Timer, error) {
+	t := r.newTimer(nil, opts)
+	if err := t.arm(absoluteTimespec(at), TimeoutAbs); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// AfterFunc calls f in its own goroutine after the duration.
+func (r *Ring) AfterFunc(d time.Duration, f func(), opts ...TimerOption) (*Timer, error) {
+	t := r.newTimer(f, opts)
+	if err := t.arm(relativeTimespec(d), 0); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// AfterFuncAt calls f in its own goroutine at the given time.
+func (r *Ring) AfterFuncAt(at time.Time, f func(), opts ...TimerOption) (*Timer, error) {
+	t := r.newTimer(f, opts)
+	if err := t.arm(absoluteTimespec(at), TimeoutAbs); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Sleep is used to wait for the duration or until the context is done.
+func (r *Ring) Sleep(ctx context.Context, d time.Duration) error {
+	t, err := r.NewTimer(d)
+	if err != nil {
+		return err
+	}
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		t.Stop()
+		return ctx.Err()
+	}
+}
+
+func (r *Ring) newTimer(f func(), opts []TimerOption) *Timer {
+	t := &Timer{r: r, f: f}
+	if f == nil {
+		t.c = make(chan time.Time, 1)
+		t.C = t.c
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// relativeTimespec returns a timespec for a duration.
+func relativeTimespec(d time.Duration) *syscall.Timespec {
+	if d < 0 {
+		d = 0
+	}
+	ts := syscall.NsecToTimespec(int64(d))
+	return &ts
+}
+
+// absoluteTimespec returns a CLOCK_MONOTONIC timespec for a time.
+func absoluteTimespec(at time.Time) *syscall.Timespec {
+	var now unix.Timespec
+	unix.ClockGettime(unix.CLOCK_MONOTONIC, &now)
+	ts := syscall.NsecToTimespec(now.Nano() + int64(time.Until(at)))
+	return &ts
+}
+
+// arm is used to submit a timeout for the timer.
+func (t *Timer) arm(ts *syscall.Timespec, flags int) error {
+	q := t.r.timerQueue()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	id, err := t.r.PrepareTimeout(ts, t.count, flags)
+	if err != nil {
+		return err
+	}
+	t.id = id
+	t.active = true
+	q.mu.Lock()
+	q.armed[id] = armedTimer{t: t, ts: ts}
+	q.mu.Unlock()
+	t.r.streamTo(id, q.c)
+	return nil
+}
+
+// expired is called when the timeout completes.
+func (t *Timer) expired(cqe CompletionEntry) {
+	t.mu.Lock()
+	if !t.active || t.id != cqe.UserData {
+		// The timer was stopped or reset.
+		t.mu.Unlock()
+		return
+	}
+	t.active = false
+	t.mu.Unlock()
+
+	// A count based timeout completes successfully, otherwise it expires
+	// with ETIME.
+	if cqe.Res < 0 && syscall.Errno(-cqe.Res) != syscall.ETIME {
+		return
+	}
+	if t.f != nil {
+		go t.f()
+		return
+	}
+	select {
+	case t.c <- time.Now():
+	default:
+	}
+}
+
+// Stop is used to prevent the timer from firing, it returns false if the
+// timer has already fired or been stopped.
+func (t *Timer) Stop() bool {
+	t.mu.Lock()
+	if !t.active {
+		t.mu.Unlock()
+		return false
+	}
+	id := t.id
+	t.mu.Unlock()
+
+	if err := t.r.TimeoutRemove(id, 0); err != nil {
+		// The timeout expired before it could be removed, the
+		// expiry is still delivered.
+		return false
+	}
+	t.mu.Lock()
+	if t.id == id {
+		t.active = false
+	}
+	t.mu.Unlock()
+	return true
+}
+
+// Reset is used to change the timer to fire after the duration, it returns
+// true if the timer was active.
+func (t *Timer) Reset(d time.Duration) (bool, error) {
+	active := t.Stop()
+	t.drain()
+	return active, t.arm(relativeTimespec(d), 0)
+}
+
+// ResetAt is used to change the timer to fire at the given time, it returns
+// true if the timer was active.
+func (t *Timer) ResetAt(at time.Time) (bool, error) {
+	active := t.Stop()
+	t.drain()
+	return active, t.arm(absoluteTimespec(at), TimeoutAbs)
+}
+
+// drain is used to remove a stale value from the timer's channel.
+func (t *Timer) drain() {
+	if t.c == nil {
+		return
+	}
+	select {
+	case <-t.c:
+	default:
+	}
+}
@@ -0,0 +1,152 @@
+// +build linux
+
+package iouring
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRingTimeout(t *testing.T) {
+	r, err := New(2048, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+
+	start := time.Now()
+	require.NoError(t, r.Timeout(relativeTimespec(5*time.Millisecond), 0, 0))
+	require.True(t, time.Since(start) >= 5*time.Millisecond)
+
+	id, err := r.PrepareTimeout(relativeTimespec(time.Hour), 0, 0)
+	require.NoError(t, err)
+	require.NoError(t, r.TimeoutRemove(id, 0))
+}
+
+func TestRingNewTimer(t *testing.T) {
+	r, err := New(2048, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+
+	start := time.Now()
+	timer, err := r.NewTimer(5 * time.Millisecond)
+	require.NoError(t, err)
+	<-timer.C
+	require.True(t, time.Since(start) >= 5*time.Millisecond)
+	require.False(t, timer.Stop())
+
+	timer, err = r.NewTimer(time.Hour)
+	require.NoError(t, err)
+	require.True(t, timer.Stop())
+	require.False(t, timer.Stop())
+
+	active, err := timer.Reset(5 * time.Millisecond)
+	require.NoError(t, err)
+	require.False(t, active)
+	<-timer.C
+
+	timer, err = r.NewTimerAt(time.Now().Add(5 * time.Millisecond))
+	require.NoError(t, err)
+	<-timer.C
+	active, err = timer.ResetAt(time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	require.False(t, active)
+	require.True(t, timer.Stop())
+}
+
+func TestRingTimerStopExpired(t *testing.T) {
+	r, err := New(2048, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+
+	timer, err := r.NewTimer(time.Millisecond)
+	require.NoError(t, err)
+	// Hold the expiry in the timer queue so the timeout has completed
+	// but hasn't been delivered when Stop is called.
+	q := r.timerQueue()
+	q.mu.Lock()
+	time.Sleep(10 * time.Millisecond)
+	require.False(t, timer.Stop())
+	q.mu.Unlock()
+	select {
+	case <-timer.C:
+	case <-time.After(time.Second):
+		t.Fatal("expired timer didn't fire after Stop")
+	}
+}
+
+func TestRingTimerUnavailable(t *testing.T) {
+	r, err := New(2048, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+
+	// The ring doesn't accept requests once it has been exported.
+	atomic.StoreInt32(&r.exported, 1)
+	_, err = r.NewTimer(time.Millisecond)
+	require.Equal(t, errRingUnavailable, err)
+	_, err = r.AfterFunc(time.Millisecond, func() {})
+	require.Equal(t, errRingUnavailable, err)
+	require.Equal(t, errRingUnavailable, r.Sleep(context.Background(), time.Millisecond))
+}
+
+func TestRingAfterFunc(t *testing.T) {
+	r, err := New(2048, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+
+	fired := make(chan struct{}, 1)
+	_, err = r.AfterFunc(time.Millisecond, func() {
+		fired <- struct{}{}
+	})
+	require.NoError(t, err)
+	<-fired
+
+	timer, err := r.AfterFunc(time.Hour, func() {
+		fired <- struct{}{}
+	})
+	require.NoError(t, err)
+	require.True(t, timer.Stop())
+	select {
+	case <-fired:
+		t.Fatal("stopped timer fired")
+	case <-time.After(5 * time.Millisecond):
+	}
+
+	_, err = r.AfterFuncAt(time.Now().Add(time.Millisecond), func() {
+		fired <- struct{}{}
+	})
+	require.NoError(t, err)
+	<-fired
+}
+
+func TestRingTimerCount(t *testing.T) {
+	r, err := New(2048, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+
+	timer, err := r.NewTimer(time.Hour, WithTimerCount(2))
+	require.NoError(t, err)
+	require.NoError(t, r.Nop())
+	require.NoError(t, r.Nop())
+	select {
+	case <-timer.C:
+	case <-time.After(time.Second):
+		t.Fatal("count timer didn't fire")
+	}
+}
+
+func TestRingSleep(t *testing.T) {
+	r, err := New(2048, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+
+	start := time.Now()
+	require.NoError(t, r.Sleep(context.Background(), 5*time.Millisecond))
+	require.True(t, time.Since(start) >= 5*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	require.Equal(t, context.DeadlineExceeded, r.Sleep(ctx, time.Hour))
+}
@@ -6,6 +6,7 @@ import (
 	"runtime"
 	"sync"
 	"sync/atomic"
+	"unsafe"
 
 	"github.com/pkg/errors"
 )
@@ -20,6 +21,10 @@ var (
 	// ErrEntryNotFound is returned when a CQE is not found.
 	ErrEntryNotFound = errors.New("Completion entry not found")
 
+	// ErrNotSupported is returned when the kernel doesn't support an
+	// operation or feature.
+	ErrNotSupported = errors.New("not supported by the kernel")
+
 	errCQEMissing = errors.New("cqe missing")
 
 	cqePool = sync.Pool{
@@ -33,7 +38,23 @@ type completionRequest struct {
 	id    uint64
 	res   int32
 	flags uint32
+	big   [2]uint64
 	done  chan struct{}
+	// stream is used for multishot requests that produce multiple
+	// completions.
+	stream chan CompletionEntry
+	// bigStream is used for multishot requests on rings setup with
+	// SetupCQE32, see Ring.StreamBig.
+	bigStream chan BigCompletionEntry
+	// shared is set when the stream is shared by multiple requests and
+	// must not be closed after the final completion.
+	shared bool
+
+	// mu guards the completions that are buffered while the stream is
+	// full, see Ring.deliver.
+	mu       sync.Mutex
+	backlog  []BigCompletionEntry
+	canceled bool
 }
 
 // Params are used to configured a io uring.
@@ -100,6 +121,7 @@ func (e *SubmitEntry) Reset() {
 	e.Len = 0
 	e.UFlags = 0
 	e.UserData = 0
+	e.Anon0 = [24]byte{}
 }
 
 // SubmitQueue represents the submit queue ring buffer.
@@ -113,10 +135,14 @@ type SubmitQueue struct {
 
 	// Array holds entries to be submitted; it must never be resized it is mmap'd.
 	Array []uint32
-	// Entries must never be resized, it is mmap'd.
+	// Entries must never be resized, it is mmap'd. When the ring was setup
+	// with SetupSQE128 each entry is followed by its extra 64 bytes, use
+	// Entry for indexing.
 	Entries []SubmitEntry
 	// ptr is pointer to the start of the mmap.
 	ptr uintptr
+	// shift is the stride of Entries as a shift.
+	shift uint32
 
 	// entered is when the ring is being entered.
 	entered *uint32
@@ -127,25 +153,49 @@ type SubmitQueue struct {
 
 // Reset is used to reset all entries.
 func (s *SubmitQueue) Reset() {
-	for _, entry := range s.Entries {
-		entry.Reset()
+	for i := uint32(0); i < s.Len(); i++ {
+		s.Entry(i).Reset()
 	}
 }
 
+// Len returns the number of entries in the SubmitQueue.
+func (s *SubmitQueue) Len() uint32 {
+	return uint32(len(s.Entries)) >> s.shift
+}
+
+// Entry returns the entry at an index.
+func (s *SubmitQueue) Entry(idx uint32) *SubmitEntry {
+	return &s.Entries[idx<<s.shift]
+}
+
+// Cmd returns the command data of an entry, which starts at addr3. It is 16
+// bytes or 80 bytes when the ring was setup with SetupSQE128. The entry must
+// be from the SubmitQueue.
+func (s *SubmitQueue) Cmd(e *SubmitEntry) []byte {
+	n := 16 + int(s.shift)*int(sqeSize)
+	return (*[16 + 64]byte)(unsafe.Pointer(&e.Anon0[8]))[:n:n]
+}
+
 // NeedWakeup is used to determine whether the submit queue needs awoken.
 func (s *SubmitQueue) NeedWakeup() bool {
 	return atomic.LoadUint32(s.Flags)&SqNeedWakeup != 0
 }
 
+// TaskrunPending returns if the kernel has task work pending that requires
+// entering the ring with EnterGetEvents, it is only set for rings setup with
+// SetupTaskrunFlag.
+func (s *SubmitQueue) TaskrunPending() bool {
+	return atomic.LoadUint32(s.Flags)&SqTaskrun != 0
+}
+
 func (s *SubmitQueue) enterLock() {
-	for {
-		if atomic.LoadUint32(s.writes) != 0 && atomic.LoadUint32(s.entered) == 1 {
-			runtime.Gosched()
-			continue
-		}
-		if atomic.CompareAndSwapUint32(s.entered, 0, 1) {
-			break
-		}
+	for !atomic.CompareAndSwapUint32(s.entered, 0, 1) {
+		runtime.Gosched()
+	}
+	// Wait for any writers that reserved an entry before the ring was
+	// marked as entered.
+	for atomic.LoadUint32(s.writes) != 0 {
+		runtime.Gosched()
 	}
 }
 
@@ -175,6 +225,13 @@ type CompletionEntry struct {
 	Flags    uint32
 }
 
+// BigCompletionEntry is a CompletionEntry with the extra data of a ring that
+// was setup with SetupCQE32.
+type BigCompletionEntry struct {
+	CompletionEntry
+	Big [2]uint64
+}
+
 // IsZero returns if the CQE is zero valued.
 func (c *CompletionEntry) IsZero() bool {
 	return c.UserData == 0 && c.Res == 0 && c.Flags == 0
@@ -189,9 +246,33 @@ type CompletionQueue struct {
 	Overflow *uint32
 	Flags    *uint32
 
-	// Entries must never be resized, it is mmap'd.
+	// Entries must never be resized, it is mmap'd. When the ring was setup
+	// with SetupCQE32 each entry is followed by its extra 16 bytes, use
+	// Entry for indexing.
 	Entries []CompletionEntry
 	ptr     uintptr
+	// shift is the stride of Entries as a shift.
+	shift uint32
+}
+
+// Len returns the number of entries in the CompletionQueue.
+func (c *CompletionQueue) Len() uint32 {
+	return uint32(len(c.Entries)) >> c.shift
+}
+
+// Entry returns the entry at an index.
+func (c *CompletionQueue) Entry(idx uint32) *CompletionEntry {
+	return &c.Entries[idx<<c.shift]
+}
+
+// Big returns the extra data of an entry when the ring was setup with
+// SetupCQE32, otherwise it returns nil. The entry must be from the
+// CompletionQueue.
+func (c *CompletionQueue) Big(e *CompletionEntry) *[2]uint64 {
+	if c.shift == 0 {
+		return nil
+	}
+	return (*[2]uint64)(unsafe.Pointer(uintptr(unsafe.Pointer(e)) + cqeSize))
 }
 
 // Advance is used to advance the completion queue by a count.
@@ -216,8 +297,8 @@ func (c *CompletionQueue) EntryBy(userData uint64) (*CompletionEntry, error) {
 	seenIdx := head & mask
 	seen := false
 	seenEnd := false
-	for i := seenIdx; i <= uint32(len(c.Entries)-1); i++ {
-		cqe := c.Entries[i]
+	for i := seenIdx; i <= c.Len()-1; i++ {
+		cqe := *c.Entry(i)
 		if cqe.Flags&CqSeenFlag == CqSeenFlag || cqe.IsZero() {
 			seen = true
 		} else if !seenEnd {
@@ -228,12 +309,12 @@ func (c *CompletionQueue) EntryBy(userData uint64) (*CompletionEntry, error) {
 			seenIdx = i + 1
 		}
 		if cqe.UserData == userData {
-			c.Entries[i].Flags |= CqSeenFlag
+			c.Entry(i).Flags |= CqSeenFlag
 			if seenIdx == c.Size {
 				seenIdx = 0
 			}
 			atomic.StoreUint32(c.Head, seenIdx)
-			return &c.Entries[i], nil
+			return c.Entry(i), nil
 		}
 	}
 	// Handle wrapping.
@@ -243,7 +324,7 @@ func (c *CompletionQueue) EntryBy(userData uint64) (*CompletionEntry, error) {
 	tail = atomic.LoadUint32(c.Tail)
 	mask = atomic.LoadUint32(c.Mask)
 	for i := uint32(0); i <= tail&mask; i++ {
-		cqe := c.Entries[i]
+		cqe := *c.Entry(i)
 		if cqe.Flags&CqSeenFlag == CqSeenFlag || cqe.IsZero() {
 			seen = true
 		} else if !seenEnd {
@@ -254,12 +335,12 @@ func (c *CompletionQueue) EntryBy(userData uint64) (*CompletionEntry, error) {
 			seenIdx = i + 1
 		}
 		if cqe.UserData == userData {
-			c.Entries[i].Flags |= CqSeenFlag
+			c.Entry(i).Flags |= CqSeenFlag
 			if seenIdx == c.Size {
 				seenIdx = 0
 			}
 			atomic.StoreUint32(c.Head, seenIdx)
-			return &c.Entries[i], nil
+			return c.Entry(i), nil
 		}
 	}
 
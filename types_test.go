@@ -276,3 +276,16 @@ func TestReadWriterEOF(t *testing.T) {
 	f.Close()
 	os.Remove(f.Name())
 }
+
+func TestQueueEntryStride(t *testing.T) {
+	sq := SubmitQueue{Entries: make([]SubmitEntry, 8)}
+	require.Equal(t, uint32(8), sq.Len())
+	require.Equal(t, &sq.Entries[3], sq.Entry(3))
+	require.Len(t, sq.Cmd(sq.Entry(0)), 16)
+
+	cq := CompletionQueue{Entries: make([]CompletionEntry, 8), shift: 1}
+	require.Equal(t, uint32(4), cq.Len())
+	require.Equal(t, &cq.Entries[6], cq.Entry(3))
+	cq.Entries[7].UserData = 42
+	require.Equal(t, uint64(42), cq.Big(cq.Entry(3))[0])
+}
@@ -32,6 +32,17 @@ func Setup(entries uint, params *Params) (int, error) {
 	return int(fd), nil
 }
 
+// setupSupported returns if the kernel accepts the setup flags, it is used to
+// tell unsupported flags apart from other invalid arguments.
+func setupSupported(flags uint32) bool {
+	fd, err := Setup(1, &Params{Flags: flags})
+	if err != nil {
+		return false
+	}
+	syscall.Close(fd)
+	return true
+}
+
 // MmapRing is used to configure the submit and completion queues, it should only
 // be called after the Setup function has completed successfully.
 // See:
@@ -44,8 +55,17 @@ func MmapRing(fd int, p *Params, sq *SubmitQueue, cq *CompletionQueue) error {
 		err   error
 	)
 	singleMmap := p.Flags&FeatSingleMmap != 0
+	// Big entries are indexed as pairs of entries.
+	if p.Flags&SetupSQE128 != 0 {
+		sq.shift = 1
+	}
+	if p.Flags&SetupCQE32 != 0 {
+		cq.shift = 1
+	}
+	sqEntries := uint(p.SqEntries) << sq.shift
+	cqEntries := uint(p.CqEntries) << cq.shift
 	sq.Size = uint32(uint(p.SqOffset.Array) + (uint(p.SqEntries) * uint(uint32Size)))
-	cq.Size = uint32(uint(p.CqOffset.Cqes) + (uint(p.CqEntries) * uint(cqeSize)))
+	cq.Size = uint32(uint(p.CqOffset.Cqes) + (cqEntries * uint(cqeSize)))
 
 	if singleMmap {
 		if cq.Size > sq.Size {
@@ -85,7 +105,7 @@ func MmapRing(fd int, p *Params, sq *SubmitQueue, cq *CompletionQueue) error {
 	sqePtr, _, errno := syscall.Syscall6(
 		syscall.SYS_MMAP,
 		uintptr(0),
-		uintptr(uint(p.SqEntries)*uint(sqeSize)),
+		uintptr(sqEntries*uint(sqeSize)),
 		syscall.PROT_READ|syscall.PROT_WRITE,
 		syscall.MAP_SHARED|syscall.MAP_POPULATE,
 		uintptr(fd),
@@ -99,8 +119,8 @@ func MmapRing(fd int, p *Params, sq *SubmitQueue, cq *CompletionQueue) error {
 	// BUG: don't use composite literals
 	sq.Entries = *(*[]SubmitEntry)(unsafe.Pointer(&reflect.SliceHeader{
 		Data: uintptr(sqePtr),
-		Len:  int(p.SqEntries),
-		Cap:  int(p.SqEntries),
+		Len:  int(sqEntries),
+		Cap:  int(sqEntries),
 	}))
 	// BUG: don't use composite literals
 	sq.Array = *(*[]uint32)(unsafe.Pointer(&reflect.SliceHeader{
@@ -136,8 +156,8 @@ func MmapRing(fd int, p *Params, sq *SubmitQueue, cq *CompletionQueue) error {
 	// BUG: don't use composite literals
 	cq.Entries = *(*[]CompletionEntry)(unsafe.Pointer(&reflect.SliceHeader{
 		Data: uintptr(uint(cqPtr) + uint(p.CqOffset.Cqes)),
-		Len:  int(p.CqEntries),
-		Cap:  int(p.CqEntries),
+		Len:  int(cqEntries),
+		Cap:  int(cqEntries),
 	}))
 	// See: https://github.com/jlauinger/go-safer
 	runtime.KeepAlive(cqPtr)
@@ -35,3 +35,11 @@ func saferStringToBytes(s *string) []byte {
 
 	return bytes
 }
+
+// cString returns a NUL terminated copy of a string for passing to the
+// kernel.
+func cString(s string) []byte {
+	b := make([]byte, len(s)+1)
+	copy(b, s)
+	return b
+}
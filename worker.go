@@ -0,0 +1,277 @@
+// +build linux
+
+package iouring
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// deferTaskrunInterval is how often an idle worker enters a ring that was
+// setup with SetupDeferTaskrun.
+const deferTaskrunInterval = time.Millisecond
+
+// enterRequest is a request for the worker to enter the ring.
+type enterRequest struct {
+	// next must only be accessed atomically, it is used by the enterQueue.
+	next unsafe.Pointer
+
+	toSubmit    uint
+	minComplete uint
+	flags       uint
+	sigset      *unix.Sigset_t
+	// fn is called on the worker thread instead of entering the ring when
+	// it is set.
+	fn func() error
+
+	n    int
+	err  error
+	done chan struct{}
+}
+
+// enterQueue is an intrusive lock-free multi producer single consumer queue,
+// see:
+// http://www.1024cores.net/home/lock-free-algorithms/queues/intrusive-mpsc-node-based-queue
+type enterQueue struct {
+	// head is where producers push requests.
+	head unsafe.Pointer
+	// tail is only accessed by the consumer.
+	tail *enterRequest
+	stub enterRequest
+}
+
+func newEnterQueue() *enterQueue {
+	q := &enterQueue{}
+	q.head = unsafe.Pointer(&q.stub)
+	q.tail = &q.stub
+	return q
+}
+
+// push adds a request to the queue, it is safe for calling concurrently.
+func (q *enterQueue) push(req *enterRequest) {
+	atomic.StorePointer(&req.next, nil)
+	prev := (*enterRequest)(atomic.SwapPointer(&q.head, unsafe.Pointer(req)))
+	atomic.StorePointer(&prev.next, unsafe.Pointer(req))
+}
+
+// pop removes a request from the queue, it returns nil if the queue is empty
+// or a producer is in the middle of a push. It must only be called by the
+// consumer.
+func (q *enterQueue) pop() *enterRequest {
+	tail := q.tail
+	next := (*enterRequest)(atomic.LoadPointer(&tail.next))
+	if tail == &q.stub {
+		if next == nil {
+			return nil
+		}
+		q.tail = next
+		tail = next
+		next = (*enterRequest)(atomic.LoadPointer(&tail.next))
+	}
+	if next != nil {
+		q.tail = next
+		return tail
+	}
+	if tail != (*enterRequest)(atomic.LoadPointer(&q.head)) {
+		// A producer has swapped the head but not linked it yet.
+		return nil
+	}
+	q.push(&q.stub)
+	next = (*enterRequest)(atomic.LoadPointer(&tail.next))
+	if next != nil {
+		q.tail = next
+		return tail
+	}
+	return nil
+}
+
+// lockedWorker is a goroutine locked to an OS thread that owns entering the
+// ring and reaping the CompletionQueue.
+type lockedWorker struct {
+	r     *Ring
+	cpus  []int
+	q     *enterQueue
+	wake  chan struct{}
+	done  chan struct{}
+	exit  chan struct{}
+	reqs  sync.Pool
+	state uint32
+}
+
+func newLockedWorker(r *Ring, cpus []int) *lockedWorker {
+	return &lockedWorker{
+		r:    r,
+		cpus: cpus,
+		q:    newEnterQueue(),
+		wake: make(chan struct{}, 1),
+		done: make(chan struct{}),
+		exit: make(chan struct{}),
+		reqs: sync.Pool{
+			New: func() interface{} {
+				return &enterRequest{done: make(chan struct{}, 1)}
+			},
+		},
+	}
+}
+
+// start starts the worker and waits for it to lock its thread.
+func (w *lockedWorker) start() error {
+	errCh := make(chan error, 1)
+	go w.run(errCh)
+	return <-errCh
+}
+
+// enter has the worker enter the ring and waits for the result.
+func (w *lockedWorker) enter(toSubmit uint, minComplete uint, flags uint, sigset *unix.Sigset_t) (int, error) {
+	req := w.reqs.Get().(*enterRequest)
+	req.toSubmit = toSubmit
+	req.minComplete = minComplete
+	req.flags = flags
+	req.sigset = sigset
+	return w.submit(req)
+}
+
+// do calls fn on the worker thread and waits for the result.
+func (w *lockedWorker) do(fn func() error) error {
+	req := w.reqs.Get().(*enterRequest)
+	req.fn = fn
+	_, err := w.submit(req)
+	return err
+}
+
+// submit queues a request for the worker and waits for the result.
+func (w *lockedWorker) submit(req *enterRequest) (int, error) {
+	w.q.push(req)
+	w.notify()
+
+	select {
+	case <-req.done:
+	case <-w.exit:
+		// The worker may have handled the request before exiting.
+		select {
+		case <-req.done:
+		default:
+			return 0, errRingUnavailable
+		}
+	}
+	n, err := req.n, req.err
+	req.sigset = nil
+	req.fn = nil
+	req.err = nil
+	w.reqs.Put(req)
+	return n, err
+}
+
+// notify wakes the worker if it is parked or waiting for completions.
+func (w *lockedWorker) notify() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+	w.r.wake()
+}
+
+// idle returns if the worker has nothing to do but wait for completions.
+func (w *lockedWorker) idle() bool {
+	select {
+	case <-w.done:
+		return false
+	default:
+	}
+	return len(w.wake) == 0 && len(w.r.completions) == 0
+}
+
+func (w *lockedWorker) run(errCh chan<- error) {
+	defer close(w.exit)
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	// Registered ring fds belong to the thread, they must be unregistered
+	// before the thread is unlocked.
+	defer w.r.unregisterRingFd()
+
+	if len(w.cpus) > 0 {
+		var set unix.CPUSet
+		for _, cpu := range w.cpus {
+			set.Set(cpu)
+		}
+		if err := unix.SchedSetaffinity(0, &set); err != nil {
+			errCh <- errors.Wrap(err, "failed to set worker cpu affinity")
+			return
+		}
+	}
+	errCh <- nil
+
+	r := w.r
+	var tick <-chan time.Time
+	if r.p.Flags&SetupDeferTaskrun != 0 {
+		// Completions of requests that aren't waited on, such as
+		// multishot requests, are only posted when the ring is entered.
+		t := time.NewTicker(deferTaskrunInterval)
+		defer t.Stop()
+		tick = t.C
+	}
+	inflight := map[uint64]*completionRequest{}
+	for {
+		// Consume the wake before the queue so that a request pushed
+		// after the queue is drained leaves the worker busy.
+		select {
+		case <-w.wake:
+		default:
+		}
+		for req := w.q.pop(); req != nil; req = w.q.pop() {
+			if req.fn != nil {
+				req.err = req.fn()
+			} else {
+				req.n, req.err = r.enter(req.toSubmit, req.minComplete, req.flags, req.sigset)
+			}
+			req.done <- struct{}{}
+		}
+	completions:
+		for {
+			select {
+			case <-w.done:
+				return
+			case cr := <-r.completions:
+				inflight[cr.id] = cr
+			default:
+				break completions
+			}
+		}
+		if len(inflight) > 0 {
+			// Wait in the kernel until a completion arrives or the
+			// worker is notified.
+			r.reap(inflight, w.idle)
+			continue
+		}
+
+		// Nothing is in flight so park until there is work.
+		select {
+		case <-w.done:
+			return
+		case <-w.wake:
+		case <-tick:
+			_, err := r.enter(0, 0, EnterGetEvents, nil)
+			if err != nil && r.enterErrHandler != nil {
+				r.enterErrHandler(err)
+			}
+		case cr := <-r.completions:
+			inflight[cr.id] = cr
+		}
+	}
+}
+
+// stop stops the worker, requests that haven't been handled return an error.
+func (w *lockedWorker) stop() {
+	if !atomic.CompareAndSwapUint32(&w.state, 0, 1) {
+		return
+	}
+	close(w.done)
+	w.r.wake()
+	<-w.exit
+}
@@ -0,0 +1,108 @@
+// +build linux
+
+package iouring
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnterQueue(t *testing.T) {
+	q := newEnterQueue()
+	require.Nil(t, q.pop())
+
+	const (
+		producers = 4
+		pushes    = 1000
+	)
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < pushes; i++ {
+				q.push(&enterRequest{toSubmit: uint(p), minComplete: uint(i)})
+			}
+		}(p)
+	}
+
+	// Requests from each producer must be popped in the order they were
+	// pushed.
+	next := make([]uint, producers)
+	popped := 0
+	for popped < producers*pushes {
+		req := q.pop()
+		if req == nil {
+			continue
+		}
+		require.Equal(t, next[req.toSubmit], req.minComplete)
+		next[req.toSubmit]++
+		popped++
+	}
+	wg.Wait()
+	require.Nil(t, q.pop())
+}
+
+func TestWithLockedThread(t *testing.T) {
+	r, err := New(2048, nil, WithLockedThread(0))
+	require.NoError(t, err)
+	require.NotNil(t, r.worker)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				require.NoError(t, r.Nop())
+			}
+		}()
+	}
+	wg.Wait()
+
+	f, err := ioutil.TempFile("", "locked")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+	rw, err := r.FileReadWriter(f)
+	require.NoError(t, err)
+	n, err := rw.Write([]byte("locked"))
+	require.NoError(t, err)
+	require.Equal(t, 6, n)
+
+	require.NoError(t, r.Stop())
+	_, err = r.Enter(0, 0, 0, nil)
+	require.Error(t, err)
+}
+
+func TestWithLockedThreadIdle(t *testing.T) {
+	r, err := New(2048, nil, WithLockedThread(0))
+	require.NoError(t, err)
+	defer r.Stop()
+	testRingIdle(t, r)
+}
+
+func TestWithLockedThreadInvalidCPU(t *testing.T) {
+	_, err := New(2048, nil, WithLockedThread(1023))
+	require.Error(t, err)
+}
+
+func BenchmarkNopLockedThread(b *testing.B) {
+	r, err := New(2048, nil, WithLockedThread())
+	require.NoError(b, err)
+	require.NotNil(b, r)
+	defer r.Stop()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err = r.Nop()
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
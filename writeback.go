@@ -0,0 +1,164 @@
+// +build linux
+
+package iouring
+
+import (
+	"math"
+	"sync"
+)
+
+// SyncFileRangeFlags are the flags of a sync_file_range(2) call.
+type SyncFileRangeFlags uint32
+
+const (
+	// SyncFileRangeWaitBefore waits for writeback of the range that was
+	// already started.
+	SyncFileRangeWaitBefore SyncFileRangeFlags = 1
+	// SyncFileRangeWrite starts writeback of dirty pages in the range.
+	SyncFileRangeWrite SyncFileRangeFlags = 2
+	// SyncFileRangeWaitAfter waits for writeback of the range after
+	// starting it.
+	SyncFileRangeWaitAfter SyncFileRangeFlags = 4
+)
+
+// PrepareSyncFileRange is used to prepare a SQE for a sync_file_range(2)
+// call. The length is limited to 32 bits, a length of 0 syncs to the end of
+// the file.
+func (r *Ring) PrepareSyncFileRange(
+	fd int,
+	offset int64,
+	n uint32,
+	flags SyncFileRangeFlags,
+	opts ...OpOption,
+) (uint64, error) {
+	sqe, ready := r.SubmitEntry()
+	if sqe == nil {
+		return 0, errRingUnavailable
+	}
+
+	sqe.Opcode = SyncFileRange
+	sqe.UserData = r.ID()
+	sqe.Fd = int32(fd)
+	sqe.Offset = uint64(offset)
+	sqe.Len = n
+	sqe.UFlags = int32(flags)
+
+	r.applyOpOptions(sqe, opts)
+	ready()
+	return sqe.UserData, nil
+}
+
+// SyncFileRange implements sync_file_range using a ring.
+func (r *Ring) SyncFileRange(fd int, offset int64, n uint32, flags SyncFileRangeFlags, opts ...OpOption) error {
+	id, err := r.PrepareSyncFileRange(fd, offset, n, flags, opts...)
+	if err != nil {
+		return err
+	}
+	_, err = r.wait(id)
+	return err
+}
+
+// FileOption is used to configure the value returned by
+// Ring.FileReadWriter.
+type FileOption func(*ringFIO)
+
+// WritebackPolicy is used to bound the amount of dirty memory of sequential
+// writes. After each Window bytes is written writeback of the range is
+// started and the writer waits for writeback of the previous range, so at
+// most two windows are dirty.
+type WritebackPolicy struct {
+	// Window is the number of bytes written before writeback is started.
+	Window int64
+}
+
+// WithWritebackPolicy is used to set the WritebackPolicy of a writer.
+func WithWritebackPolicy(p WritebackPolicy) FileOption {
+	return func(i *ringFIO) {
+		if p.Window > 0 {
+			i.wb = &writeback{window: p.Window}
+		}
+	}
+}
+
+// writeback tracks the written ranges of a file for a WritebackPolicy.
+type writeback struct {
+	mu     sync.Mutex
+	window int64
+	// start and end are the contiguous range that hasn't been submitted
+	// for writeback.
+	start int64
+	end   int64
+	// prevStart and prevEnd are the range that writeback was started on
+	// but hasn't been waited on.
+	prevStart int64
+	prevEnd   int64
+}
+
+// written is called after a write completes, it returns the range that
+// writeback should be started for and the range to wait on. Empty ranges are
+// returned when nothing should be done.
+func (w *writeback) written(off int64, n int64) (start, end, waitStart, waitEnd int64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if off != w.end {
+		// Not sequential, start tracking a new range.
+		w.start = off
+	}
+	w.end = off + n
+	if w.end-w.start < w.window {
+		return 0, 0, 0, 0
+	}
+	start, end = w.start, w.end
+	waitStart, waitEnd = w.prevStart, w.prevEnd
+	w.prevStart, w.prevEnd = start, end
+	w.start = end
+	return start, end, waitStart, waitEnd
+}
+
+// writeback is used to apply the WritebackPolicy of a writer after a write.
+func (i *ringFIO) writeback(off int64, n int) error {
+	if i.wb == nil || n <= 0 {
+		return nil
+	}
+	start, end, waitStart, waitEnd := i.wb.written(off, int64(n))
+	if start == end {
+		return nil
+	}
+	// All requests are submitted together.
+	ids, err := i.prepareSyncRange(start, end, SyncFileRangeWrite)
+	if err == nil && waitStart != waitEnd {
+		var waitIDs []uint64
+		waitIDs, err = i.prepareSyncRange(
+			waitStart,
+			waitEnd,
+			SyncFileRangeWaitBefore|SyncFileRangeWrite|SyncFileRangeWaitAfter,
+		)
+		ids = append(ids, waitIDs...)
+	}
+	for _, id := range ids {
+		if _, werr := i.r.wait(id); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	return err
+}
+
+// prepareSyncRange is used to prepare the sync_file_range(2) calls for a
+// range, the range is split as the length of a call is limited to 32 bits.
+func (i *ringFIO) prepareSyncRange(start, end int64, flags SyncFileRangeFlags) ([]uint64, error) {
+	var ids []uint64
+	for start < end {
+		n := end - start
+		if n > math.MaxUint32 {
+			n = math.MaxUint32
+		}
+		id, err := i.r.PrepareSyncFileRange(int(i.fd), start, uint32(n), flags)
+		if err != nil {
+			return ids, err
+		}
+		ids = append(ids, id)
+		start += n
+	}
+	return ids, nil
+}
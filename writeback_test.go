@@ -0,0 +1,130 @@
+// +build linux
+
+package iouring
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRingSyncFileRange(t *testing.T) {
+	r, err := New(2048, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+
+	f, err := ioutil.TempFile("", "syncrange")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+	_, err = f.Write(make([]byte, 8192))
+	require.NoError(t, err)
+
+	fd := int(f.Fd())
+	require.NoError(t, r.SyncFileRange(fd, 0, 4096, SyncFileRangeWrite))
+	require.NoError(t, r.SyncFileRange(
+		fd, 0, 0,
+		SyncFileRangeWaitBefore|SyncFileRangeWrite|SyncFileRangeWaitAfter,
+	))
+	require.Error(t, r.SyncFileRange(-1, 0, 0, SyncFileRangeWrite))
+}
+
+func TestWritebackWritten(t *testing.T) {
+	w := &writeback{window: 100}
+
+	start, end, _, _ := w.written(0, 50)
+	require.Equal(t, start, end)
+	start, end, waitStart, waitEnd := w.written(50, 60)
+	require.Equal(t, int64(0), start)
+	require.Equal(t, int64(110), end)
+	require.Equal(t, waitStart, waitEnd)
+
+	start, end, waitStart, waitEnd = w.written(110, 100)
+	require.Equal(t, int64(110), start)
+	require.Equal(t, int64(210), end)
+	require.Equal(t, int64(0), waitStart)
+	require.Equal(t, int64(110), waitEnd)
+
+	// A non sequential write starts a new range.
+	start, end, _, _ = w.written(1000, 50)
+	require.Equal(t, start, end)
+	start, end, waitStart, waitEnd = w.written(1050, 50)
+	require.Equal(t, int64(1000), start)
+	require.Equal(t, int64(1100), end)
+	require.Equal(t, int64(110), waitStart)
+	require.Equal(t, int64(210), waitEnd)
+}
+
+func TestFileWritebackPolicy(t *testing.T) {
+	r, err := New(2048, nil)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+
+	f, err := ioutil.TempFile("", "writeback")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	rw, err := r.FileReadWriter(f, WithWritebackPolicy(WritebackPolicy{
+		Window: 128 * 1024,
+	}))
+	require.NoError(t, err)
+
+	chunk := bytes.Repeat([]byte("w"), 64*1024)
+	for i := 0; i < 16; i++ {
+		n, err := rw.Write(chunk)
+		require.NoError(t, err)
+		require.Equal(t, len(chunk), n)
+	}
+	n, err := rw.WriteAt(chunk, 16*int64(len(chunk)))
+	require.NoError(t, err)
+	require.Equal(t, len(chunk), n)
+
+	wb := rw.(*ringFIO).wb
+	require.Equal(t, int64(17*len(chunk)), wb.end)
+	require.Equal(t, int64(14*len(chunk)), wb.prevStart)
+	require.Equal(t, int64(16*len(chunk)), wb.prevEnd)
+
+	b, err := ioutil.ReadFile(f.Name())
+	require.NoError(t, err)
+	require.Equal(t, bytes.Repeat(chunk, 17), b)
+}
+
+func TestWritebackLargeRange(t *testing.T) {
+	var trace bytes.Buffer
+	r, err := New(2048, nil, WithRecorder(&trace))
+	require.NoError(t, err)
+	require.NotNil(t, r)
+
+	f, err := ioutil.TempFile("", "writeback")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	const size = 5 << 30
+	rw, err := r.FileReadWriter(f, WithWritebackPolicy(WritebackPolicy{
+		Window: size,
+	}))
+	require.NoError(t, err)
+	require.NoError(t, rw.(*ringFIO).writeback(0, size))
+
+	var offsets, lens []uint64
+	tr := NewTraceReader(&trace)
+	for {
+		rec, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		if rec.SQE != nil && rec.SQE.Opcode == SyncFileRange {
+			offsets = append(offsets, rec.SQE.Offset)
+			lens = append(lens, uint64(rec.SQE.Len))
+		}
+	}
+	require.Equal(t, []uint64{0, math.MaxUint32}, offsets)
+	require.Equal(t, []uint64{math.MaxUint32, size - math.MaxUint32}, lens)
+}